@@ -17,7 +17,13 @@ document.getElementById('createAppButton').addEventListener('click', function()
 
             // Extract the domain and path
             var domain = url.hostname; // domain (e.g., google.com)
-            var path = url.pathname + url.search + url.hash; // path including query and hash
+            // segments of dashes only get one more dash, a single dash separates the worker's own files
+            var pathname = url.pathname.split('/').map(segment => /^-+$/.test(segment) ? '-' + segment : segment).join('/');
+            // paths ending in a file name of the worker's apps open the app page after the dash
+            if (/\/(manifest\.json|service-worker\.js|redirect\.html|offline\.html)$/.test(pathname)) {
+                pathname += '/-/';
+            }
+            var path = pathname + url.search + url.hash; // path including query and hash
 
             // Construct the redirection URL
             var redirectUrl = 'https://intopwa.xyofn8h7t.workers.dev/a/' + encodeURIComponent(domain) + path;
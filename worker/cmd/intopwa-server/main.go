@@ -0,0 +1,428 @@
+// Command intopwa-server runs IntoPWA as a standalone HTTP server without Cloudflare.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain/icons"
+	"github.com/nazar256/intopwa/internal/domain/server"
+	cache_icons "github.com/nazar256/intopwa/internal/pkg/caching/icons"
+	"github.com/nazar256/intopwa/internal/pkg/caching/links"
+	"github.com/nazar256/intopwa/internal/pkg/caching/settings"
+	"github.com/nazar256/intopwa/internal/pkg/scrape"
+	"github.com/nazar256/intopwa/internal/pkg/urlpolicy"
+	"github.com/nazar256/intopwa/pkg/storage"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	iconsNamespace    = "icons"
+	linksNamespace    = "links"
+	settingsNamespace = "settings"
+	failuresNamespace = "failures"
+	blobsNamespace    = "blobs"
+	thirtyDays        = 30 * 24 * time.Hour
+
+	storageMemory = "memory"
+	storageDir    = "dir"
+	storageBolt   = "bolt"
+)
+
+type kv interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+}
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type blobs interface {
+	Get(path string) (io.Reader, error)
+	Put(path string, data io.Reader) error
+}
+
+type config struct {
+	addr            string
+	storage         string
+	memoryEntries   int
+	dataDir         string
+	assetsDir       string
+	iconsTTL        time.Duration
+	linksTTL        time.Duration
+	refreshAfter    time.Duration
+	failureTTL      time.Duration
+	fetchTimeout    time.Duration
+	shutdownTimeout time.Duration
+	allowHosts      string
+	denyHosts       string
+	allowPorts      string
+	allowHTTP       bool
+	probePaths      string
+	corsOrigins     string
+}
+
+func main() {
+	cfg, err := parseConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		slog.Error("server failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func parseConfig(args []string) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("intopwa-server", flag.ContinueOnError)
+	fs.StringVar(&cfg.addr, "addr", envString("INTOPWA_ADDR", ":8080"), "listen address (env INTOPWA_ADDR)")
+	fs.StringVar(&cfg.storage, "storage", envString("INTOPWA_STORAGE", storageDir), "cache storage: dir, bolt or memory (env INTOPWA_STORAGE)")
+	fs.IntVar(&cfg.memoryEntries, "memory-entries", envInt("INTOPWA_MEMORY_ENTRIES", 10000), "max cached keys per namespace for memory storage (env INTOPWA_MEMORY_ENTRIES)")
+	fs.StringVar(&cfg.dataDir, "data-dir", envString("INTOPWA_DATA_DIR", "./data"), "directory for dir and bolt storage (env INTOPWA_DATA_DIR)")
+	fs.StringVar(&cfg.assetsDir, "assets-dir", envString("INTOPWA_ASSETS_DIR", ""), "optional directory with static assets, e.g. ../public/assets (env INTOPWA_ASSETS_DIR)")
+	fs.DurationVar(&cfg.iconsTTL, "icons-ttl", envDuration("INTOPWA_ICONS_TTL", thirtyDays), "icons cache TTL (env INTOPWA_ICONS_TTL)")
+	fs.DurationVar(&cfg.linksTTL, "links-ttl", envDuration("INTOPWA_LINKS_TTL", thirtyDays), "icon links cache TTL (env INTOPWA_LINKS_TTL)")
+	fs.DurationVar(&cfg.refreshAfter, "refresh-after", envDuration("INTOPWA_REFRESH_AFTER", icons.DefaultSoftTTL), "age cached pages and icons are refreshed in the background after, 0 disables refreshing (env INTOPWA_REFRESH_AFTER)")
+	fs.DurationVar(&cfg.failureTTL, "failure-ttl", envDuration("INTOPWA_FAILURE_TTL", icons.DefaultFailureTTL), "time a page failing to scrape isn't fetched again, 0 disables caching failures (env INTOPWA_FAILURE_TTL)")
+	fs.DurationVar(&cfg.fetchTimeout, "fetch-timeout", envDuration("INTOPWA_FETCH_TIMEOUT", 15*time.Second), "timeout for outgoing requests (env INTOPWA_FETCH_TIMEOUT)")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", envDuration("INTOPWA_SHUTDOWN_TIMEOUT", 10*time.Second), "graceful shutdown timeout (env INTOPWA_SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cfg.allowHosts, "allow-hosts", envString("INTOPWA_ALLOW_HOSTS", ""), "comma separated hosts allowed to fetch, *.example.com matches subdomains, empty allows any public host (env INTOPWA_ALLOW_HOSTS)")
+	fs.StringVar(&cfg.denyHosts, "deny-hosts", envString("INTOPWA_DENY_HOSTS", ""), "comma separated hosts never fetched (env INTOPWA_DENY_HOSTS)")
+	fs.StringVar(&cfg.allowPorts, "allow-ports", envString("INTOPWA_ALLOW_PORTS", "80,443"), "comma separated ports allowed to fetch (env INTOPWA_ALLOW_PORTS)")
+	fs.BoolVar(&cfg.allowHTTP, "allow-http", envBool("INTOPWA_ALLOW_HTTP", false), "allow plain http apps and icons, e.g. /a/http/example.com:8080/ (env INTOPWA_ALLOW_HTTP)")
+	fs.StringVar(&cfg.probePaths, "probe-paths", envString("INTOPWA_PROBE_PATHS", strings.Join(scrape.DefaultProbePaths(), ",")), "comma separated well-known icon and manifest paths probed for pages linking no icons, empty disables probing (env INTOPWA_PROBE_PATHS)")
+	fs.StringVar(&cfg.corsOrigins, "cors-origins", envString("INTOPWA_CORS_ORIGINS", ""), "comma separated origins allowed to call the server from the browser, e.g. the frontend reading the API, * allows any (env INTOPWA_CORS_ORIGINS)")
+
+	err := fs.Parse(args)
+
+	return cfg, err
+}
+
+func run(ctx context.Context, cfg config) error {
+	stores, closeStores, err := openStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	refreshes := newBackgroundTasks()
+	// deferred after closeStores, so refreshes writing to the stores are over before the stores close
+	defer refreshes.stop(cfg.shutdownTimeout)
+
+	iconsKV, linksKV, settingsKV := stores[iconsNamespace], stores[linksNamespace], stores[settingsNamespace]
+	failuresKV := stores[failuresNamespace]
+
+	iconBlobs, err := openBlobs(cfg, stores[blobsNamespace])
+	if err != nil {
+		return err
+	}
+
+	policy, err := newURLPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	limits := scrape.DefaultLimits()
+	limits.RequestTimeout = cfg.fetchTimeout
+
+	scraper := scrape.NewIconsScraper(
+		newFetchClient(cfg, policy),
+		scrape.WithLimits(limits),
+		scrape.WithProbePaths(parseProbePaths(cfg.probePaths)),
+	)
+	iconsCache := cache_icons.NewCache(iconsKV, iconBlobs)
+	linksCache := links.NewCache(linksKV, failuresKV)
+	settingsCache := settings.NewCache(settingsKV)
+	fetcher := icons.NewIconsFetcher(scraper, iconsCache, linksCache, settingsCache,
+		icons.WithRefresh(cfg.refreshAfter, refreshes.run),
+		icons.WithFailureTTL(cfg.failureTTL),
+	)
+	srv := server.New(fetcher, server.WithAllowedOrigins(server.ParseOrigins(cfg.corsOrigins)...))
+
+	httpServer := &http.Server{
+		Addr:              cfg.addr,
+		Handler:           newHandler(srv.Router(), cfg.assetsDir),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", cfg.addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// backgroundTasks tracks tasks outliving requests, e.g. refreshes of stale cache entries
+type backgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (b *backgroundTasks) run(task func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		task(b.ctx)
+	}()
+}
+
+// stop waits for running tasks, the ones still running after the timeout are cancelled
+func (b *backgroundTasks) stop(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	defer b.cancel()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	slog.Warn("cancelling background tasks still running after the shutdown timeout")
+	b.cancel()
+	<-done
+}
+
+func newURLPolicy(cfg config) (urlpolicy.Policy, error) {
+	policy := urlpolicy.DefaultPolicy()
+	policy.AllowHosts = urlpolicy.ParseHostPatterns(cfg.allowHosts)
+	policy.DenyHosts = urlpolicy.ParseHostPatterns(cfg.denyHosts)
+	if cfg.allowHTTP {
+		policy = policy.WithHTTP()
+	}
+
+	policy.Ports = nil
+	for _, portStr := range strings.Split(cfg.allowPorts, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(portStr))
+		if err != nil || port <= 0 || port > 65535 {
+			return policy, fmt.Errorf("invalid port in allowed ports: %q", portStr)
+		}
+		policy.Ports = append(policy.Ports, port)
+	}
+
+	return policy, nil
+}
+
+func parseProbePaths(list string) []string {
+	var paths []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// newFetchClient returns the client for remote pages and icons. Redirects are followed by the policy client,
+// and the dialer checks the resolved address once more, so DNS rebinding can't reach internal hosts.
+func newFetchClient(cfg config, policy urlpolicy.Policy) httpClient {
+	dialer := &net.Dialer{
+		Timeout: cfg.fetchTimeout,
+		Control: policy.DialControl,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	client := &http.Client{
+		Timeout:   cfg.fetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return urlpolicy.NewClient(client, policy, net.DefaultResolver)
+}
+
+// openStores creates a KV store per cache namespace with the storage backend from the config
+func openStores(cfg config) (stores map[string]kv, closeFn func(), err error) {
+	ttls := map[string]time.Duration{
+		iconsNamespace: cfg.iconsTTL,
+		linksNamespace: cfg.linksTTL,
+		// settings never expire, the installed app relies on them
+		settingsNamespace: 0,
+		failuresNamespace: cfg.failureTTL,
+	}
+	if cfg.storage != storageDir {
+		// dir storage keeps blobs as plain files, the other backends store them as KV values
+		ttls[blobsNamespace] = cfg.iconsTTL
+	}
+	stores = make(map[string]kv, len(ttls))
+	closeFn = func() {}
+
+	switch cfg.storage {
+	case storageMemory:
+		for namespace, ttl := range ttls {
+			stores[namespace] = storage.NewMemory(cfg.memoryEntries, ttl)
+		}
+	case storageDir:
+		for namespace, ttl := range ttls {
+			stores[namespace], err = storage.NewDir(filepath.Join(cfg.dataDir, namespace), ttl)
+			if err != nil {
+				return nil, closeFn, err
+			}
+		}
+	case storageBolt:
+		err = os.MkdirAll(cfg.dataDir, 0o755)
+		if err != nil {
+			return nil, closeFn, fmt.Errorf("failed to create data directory: %w", err)
+		}
+
+		db, err := storage.OpenBolt(filepath.Join(cfg.dataDir, "intopwa.db"))
+		if err != nil {
+			return nil, closeFn, err
+		}
+		closeFn = func() {
+			if err := db.Close(); err != nil {
+				slog.Error("failed to close bolt database", "err", err)
+			}
+		}
+
+		for namespace, ttl := range ttls {
+			stores[namespace], err = storage.NewBolt(db, namespace, ttl)
+			if err != nil {
+				closeFn()
+				return nil, func() {}, err
+			}
+		}
+	default:
+		return nil, closeFn, fmt.Errorf("unknown storage: %s", cfg.storage)
+	}
+
+	return stores, closeFn, nil
+}
+
+// openBlobs returns the icon blob store, it shares the KV backend unless dir storage is used
+func openBlobs(cfg config, blobsKV kv) (blobs, error) {
+	if cfg.storage == storageDir {
+		return storage.NewBlobDir(filepath.Join(cfg.dataDir, blobsNamespace))
+	}
+	return storage.NewKVBlobs(blobsKV), nil
+}
+
+// newHandler serves app, icon and API routes with the IntoPWA router and everything else from the assets directory,
+// the same way Cloudflare serves the assets binding in front of the worker.
+func newHandler(router http.Handler, assetsDir string) http.Handler {
+	if assetsDir == "" {
+		return router
+	}
+
+	assets := http.FileServer(http.Dir(assetsDir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/a/") || strings.HasPrefix(req.URL.Path, "/i/") ||
+			strings.HasPrefix(req.URL.Path, "/api/") {
+			router.ServeHTTP(w, req)
+			return
+		}
+		assets.ServeHTTP(w, req)
+	})
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("invalid number in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return i
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("invalid duration in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return d
+}
+
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("invalid boolean in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return b
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, cfg config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg config) {
+				assert.Equal(t, ":8080", cfg.addr)
+				assert.Equal(t, storageDir, cfg.storage)
+				assert.Equal(t, 10000, cfg.memoryEntries)
+				assert.Equal(t, "./data", cfg.dataDir)
+				assert.Equal(t, thirtyDays, cfg.iconsTTL)
+				assert.Equal(t, 15*time.Second, cfg.fetchTimeout)
+				assert.Equal(t, "80,443", cfg.allowPorts)
+				assert.False(t, cfg.allowHTTP)
+			},
+		},
+		{
+			name: "environment",
+			env: map[string]string{
+				"INTOPWA_ADDR":           ":9090",
+				"INTOPWA_STORAGE":        storageBolt,
+				"INTOPWA_MEMORY_ENTRIES": "5",
+				"INTOPWA_ICONS_TTL":      "1h",
+				"INTOPWA_ALLOW_HTTP":     "true",
+				"INTOPWA_CORS_ORIGINS":   "*",
+			},
+			check: func(t *testing.T, cfg config) {
+				assert.Equal(t, ":9090", cfg.addr)
+				assert.Equal(t, storageBolt, cfg.storage)
+				assert.Equal(t, 5, cfg.memoryEntries)
+				assert.Equal(t, time.Hour, cfg.iconsTTL)
+				assert.True(t, cfg.allowHTTP)
+				assert.Equal(t, "*", cfg.corsOrigins)
+			},
+		},
+		{
+			name: "flags override environment",
+			args: []string{"-addr", ":7070", "-storage", storageMemory, "-icons-ttl", "2h", "-allow-http=false"},
+			env: map[string]string{
+				"INTOPWA_ADDR":       ":9090",
+				"INTOPWA_STORAGE":    storageBolt,
+				"INTOPWA_ICONS_TTL":  "1h",
+				"INTOPWA_ALLOW_HTTP": "true",
+			},
+			check: func(t *testing.T, cfg config) {
+				assert.Equal(t, ":7070", cfg.addr)
+				assert.Equal(t, storageMemory, cfg.storage)
+				assert.Equal(t, 2*time.Hour, cfg.iconsTTL)
+				assert.False(t, cfg.allowHTTP)
+			},
+		},
+		{
+			name: "invalid environment falls back to defaults",
+			env: map[string]string{
+				"INTOPWA_MEMORY_ENTRIES": "many",
+				"INTOPWA_ICONS_TTL":      "forever",
+				"INTOPWA_ALLOW_HTTP":     "sometimes",
+			},
+			check: func(t *testing.T, cfg config) {
+				assert.Equal(t, 10000, cfg.memoryEntries)
+				assert.Equal(t, thirtyDays, cfg.iconsTTL)
+				assert.False(t, cfg.allowHTTP)
+			},
+		},
+		{
+			name: "empty environment value is kept",
+			env:  map[string]string{"INTOPWA_PROBE_PATHS": ""},
+			check: func(t *testing.T, cfg config) {
+				assert.Empty(t, cfg.probePaths)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := parseConfig(tt.args)
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	_, err := parseConfig([]string{"-fetch-timeout", "soon"})
+	assert.Error(t, err)
+
+	_, err = parseConfig([]string{"-h"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestOpenStores(t *testing.T) {
+	tests := []struct {
+		storage    string
+		namespaces []string
+	}{
+		{storage: storageMemory, namespaces: []string{blobsNamespace, failuresNamespace, iconsNamespace, linksNamespace, settingsNamespace}},
+		// dir storage keeps blobs as plain files
+		{storage: storageDir, namespaces: []string{failuresNamespace, iconsNamespace, linksNamespace, settingsNamespace}},
+		{storage: storageBolt, namespaces: []string{blobsNamespace, failuresNamespace, iconsNamespace, linksNamespace, settingsNamespace}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.storage, func(t *testing.T) {
+			cfg, err := parseConfig([]string{"-storage", tt.storage, "-data-dir", t.TempDir()})
+			require.NoError(t, err)
+
+			stores, closeStores, err := openStores(cfg)
+			require.NoError(t, err)
+			defer closeStores()
+
+			var namespaces []string
+			for namespace := range stores {
+				namespaces = append(namespaces, namespace)
+			}
+			slices.Sort(namespaces)
+			assert.Equal(t, tt.namespaces, namespaces)
+
+			require.NoError(t, stores[iconsNamespace].Put("key", []byte("value")))
+			value, err := stores[iconsNamespace].Get("key")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("value"), value)
+
+			// namespaces don't share keys
+			value, err = stores[linksNamespace].Get("key")
+			require.NoError(t, err)
+			assert.Nil(t, value)
+		})
+	}
+}
+
+func TestOpenStoresUnknownStorage(t *testing.T) {
+	_, closeStores, err := openStores(config{storage: "redis"})
+	assert.ErrorContains(t, err, "unknown storage")
+	closeStores()
+}
+
+func TestBackgroundTasksStop(t *testing.T) {
+	tasks := newBackgroundTasks()
+
+	var finished, cancelled atomic.Bool
+	tasks.run(func(ctx context.Context) {
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(ctx.Err() == nil)
+	})
+	tasks.run(func(ctx context.Context) {
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+
+	// quick tasks are waited for, the ones still running after the timeout are cancelled
+	tasks.stop(50 * time.Millisecond)
+	assert.True(t, finished.Load())
+	assert.True(t, cancelled.Load())
+}
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PurposeAny        = "any"
+	PurposeMaskable   = "maskable"
+	PurposeMonochrome = "monochrome"
+)
+
+// Purposes are the icon purposes of the web app manifest spec
+var Purposes = []string{PurposeAny, PurposeMaskable, PurposeMonochrome}
+
+const (
+	// RelCustom marks icons chosen by the user
+	RelCustom = "custom"
+	// RelManifest marks icons declared in the site's web app manifest
+	RelManifest = "manifest"
+)
+
+// Page holds everything scraped from the app's page
+type Page struct {
+	// IconLinks are the icons linked by the page, probed well-known locations or icons chosen by the user
+	IconLinks []IconLink
+	// Manifest is the site's own web app manifest, nil when the site has none
+	Manifest *WebManifest
+	Metadata PageMetadata
+	// URL is the final URL of the page after redirects
+	URL *url.URL
+	// CanonicalURL is declared by <link rel=canonical> or og:url, nil when the page declares none
+	CanonicalURL *url.URL
+	// FetchedAt is when the page was scraped, zero for pages cached before it was recorded
+	FetchedAt time.Time
+}
+
+// IconCandidates returns the page's icon links followed by the icons declared in the site's manifest,
+// the first link of every URL is kept
+func (p Page) IconCandidates() []IconLink {
+	links := slices.Clone(p.IconLinks)
+	if p.Manifest != nil {
+		for _, icon := range p.Manifest.Icons {
+			icon.Rel = RelManifest
+			links = append(links, icon)
+		}
+	}
+
+	unique := make([]IconLink, 0, len(links))
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		if link.URL == nil {
+			continue
+		}
+		if _, ok := seen[link.URL.String()]; ok {
+			continue
+		}
+		seen[link.URL.String()] = struct{}{}
+		unique = append(unique, link)
+	}
+
+	return unique
+}
+
+// IconURLs returns URLs of the links
+func IconURLs(links []IconLink) []*url.URL {
+	urls := make([]*url.URL, 0, len(links))
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
+
+// WebManifest holds the values of the site's own web app manifest which are used as preferred values
+type WebManifest struct {
+	Name            string
+	ShortName       string
+	ThemeColor      string
+	BackgroundColor string
+	Display         string
+	Icons           []IconLink
+}
+
+// IconLink is an icon declared by the site along with its declared attributes
+type IconLink struct {
+	URL     *url.URL
+	Sizes   string
+	Type    string
+	Purpose string
+	// Rel is the rel attribute of the link tag, RelManifest or RelCustom, empty for well-known locations
+	Rel string
+	// Media is the media query of the link tag, e.g. (prefers-color-scheme: dark)
+	Media string
+}
+
+// IsScalable reports whether the link declares a vector image
+func (l IconLink) IsScalable() bool {
+	if strings.Contains(l.Type, "svg") || slices.Contains(strings.Fields(strings.ToLower(l.Sizes)), SizeAny) {
+		return true
+	}
+	if l.Type != "" || l.URL == nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(l.URL.Path), ".svg") ||
+		l.URL.Scheme == "data" && strings.HasPrefix(strings.ToLower(l.URL.Opaque), "image/svg")
+}
+
+// MaxSize returns the biggest of the declared sizes, zero when the link declares none
+func (l IconLink) MaxSize() int {
+	var maxSize int
+	for _, size := range strings.Fields(strings.ToLower(l.Sizes)) {
+		w, h, found := strings.Cut(size, "x")
+		if !found {
+			continue
+		}
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if errW != nil || errH != nil {
+			continue
+		}
+		maxSize = max(maxSize, min(width, height))
+	}
+	return maxSize
+}
+
+// App is everything known about the app needed to build its manifest
+type App struct {
+	Icons    []Icon
+	Manifest *WebManifest
+	Metadata PageMetadata
+	Settings AppSettings
+	// Identity is the URL the app is cached under, see Page.Identity
+	Identity *url.URL
+	// IconLinks are the icon candidates of the page, Icons are downloaded from the best of them
+	IconLinks []IconLink
+	// Failure is why the page couldn't be scraped, nil if it was
+	Failure *ScrapeFailure
+}
+
+// HasPurpose reports whether the space separated purpose list contains the purpose,
+// an empty list means "any" as in the web app manifest spec
+func HasPurpose(purposes, purpose string) bool {
+	if purposes == "" {
+		return purpose == PurposeAny
+	}
+	return slices.Contains(strings.Fields(purposes), purpose)
+}
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageIconCandidates(t *testing.T) {
+	touchIcon, _ := url.Parse("https://example.com/apple-touch-icon.png")
+	manifestIcon, _ := url.Parse("https://example.com/icon-512.png")
+
+	page := Page{
+		IconLinks: []IconLink{{URL: touchIcon, Rel: "apple-touch-icon"}},
+		Manifest: &WebManifest{
+			Icons: []IconLink{
+				{URL: touchIcon, Sizes: "180x180"},
+				{URL: manifestIcon, Sizes: "512x512"},
+			},
+		},
+	}
+
+	assert.Equal(t, []IconLink{
+		{URL: touchIcon, Rel: "apple-touch-icon"},
+		{URL: manifestIcon, Sizes: "512x512", Rel: RelManifest},
+	}, page.IconCandidates())
+}
+
+func TestIconLinkDeclaredAttributes(t *testing.T) {
+	svgIcon, _ := url.Parse("https://example.com/icon.svg")
+	pngIcon, _ := url.Parse("https://example.com/icon.png")
+
+	assert.True(t, IconLink{URL: svgIcon}.IsScalable())
+	assert.True(t, IconLink{URL: pngIcon, Sizes: "any"}.IsScalable())
+	assert.False(t, IconLink{URL: pngIcon, Sizes: "192x192"}.IsScalable())
+
+	assert.Equal(t, 512, IconLink{URL: pngIcon, Sizes: "16x16 512x512 192x192"}.MaxSize())
+	assert.Equal(t, 0, IconLink{URL: pngIcon, Sizes: "large"}.MaxSize())
+}
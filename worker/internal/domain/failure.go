@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// FailureStatus is an HTTP error status of the page
+	FailureStatus = "status"
+	// FailureTimeout is a page not responding in time
+	FailureTimeout = "timeout"
+	// FailureContentType is a page that isn't HTML, e.g. a PDF or an image
+	FailureContentType = "content_type"
+	// FailureFetch covers network errors, blocked URLs and oversized pages
+	FailureFetch = "fetch"
+)
+
+// ScrapeFailure tells why the app's page couldn't be scraped. Scrapers return it as an error,
+// and it's cached for a short time, so broken sites aren't fetched on every request.
+type ScrapeFailure struct {
+	Reason      string
+	Status      int
+	ContentType string
+	Message     string
+	FailedAt    time.Time
+}
+
+func (f *ScrapeFailure) Error() string {
+	if f.Message != "" {
+		return f.Message
+	}
+
+	switch f.Reason {
+	case FailureStatus:
+		return fmt.Sprintf("page responded with status %d", f.Status)
+	case FailureContentType:
+		return fmt.Sprintf("page content type is not HTML: %s", f.ContentType)
+	case FailureTimeout:
+		return "page request timed out"
+	default:
+		return "failed to fetch page"
+	}
+}
+
+// FailureOf classifies the error of scraping the page
+func FailureOf(err error) ScrapeFailure {
+	var failure *ScrapeFailure
+	if errors.As(err, &failure) {
+		classified := *failure
+		classified.Message = err.Error()
+		return classified
+	}
+
+	// the timeout interface is implemented by net errors and scrape limits
+	var timeout interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeout) && timeout.Timeout()) {
+		return ScrapeFailure{Reason: FailureTimeout, Message: err.Error()}
+	}
+
+	return ScrapeFailure{Reason: FailureFetch, Message: err.Error()}
+}
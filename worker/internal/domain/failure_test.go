@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestFailureOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ScrapeFailure
+	}{
+		{
+			name: "status",
+			err:  fmt.Errorf("failed to fetch page: %w", &ScrapeFailure{Reason: FailureStatus, Status: 404}),
+			expected: ScrapeFailure{
+				Reason:  FailureStatus,
+				Status:  404,
+				Message: "failed to fetch page: page responded with status 404",
+			},
+		},
+		{
+			name: "content type",
+			err:  &ScrapeFailure{Reason: FailureContentType, ContentType: "application/pdf"},
+			expected: ScrapeFailure{
+				Reason:      FailureContentType,
+				ContentType: "application/pdf",
+				Message:     "page content type is not HTML: application/pdf",
+			},
+		},
+		{
+			name:     "timeout",
+			err:      fmt.Errorf("failed to fetch page: %w", timeoutError{}),
+			expected: ScrapeFailure{Reason: FailureTimeout, Message: "failed to fetch page: i/o timeout"},
+		},
+		{
+			name:     "deadline",
+			err:      context.DeadlineExceeded,
+			expected: ScrapeFailure{Reason: FailureTimeout, Message: "context deadline exceeded"},
+		},
+		{
+			name:     "other",
+			err:      errors.New("connection refused"),
+			expected: ScrapeFailure{Reason: FailureFetch, Message: "connection refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FailureOf(tt.err))
+		})
+	}
+}
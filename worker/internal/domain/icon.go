@@ -1,15 +1,50 @@
 package domain
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	// IconSizeParam is the query parameter selecting a square PNG variant of an icon,
+	// e.g. /i/host/icon.ico?intopwa-size=512. The prefix keeps it apart from parameters of the sites, like ?s=192.
+	IconSizeParam = "intopwa-size"
+	// IconMaskParam is the query parameter of maskable variants holding the background color,
+	// e.g. ?intopwa-mask=3367d6&intopwa-size=512
+	IconMaskParam = "intopwa-mask"
+
+	// InlineIconDomain hosts the stable URLs of icons embedded into pages as data URIs,
+	// the reserved .invalid TLD guarantees they are never fetched from the network
+	InlineIconDomain = "inline.invalid"
+
+	defaultMaskBackground = "ffffff"
+)
+
+var (
+	maskBackground = regexp.MustCompile(`^[0-9a-f]{6}$`)
+	hexColor       = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+// VariantSizes are the square sizes icons are rasterized to when the site doesn't provide them
+var VariantSizes = []int{192, 512}
+
 type Icon struct {
 	URL   *url.URL
 	Body  []byte
 	Props ImageProps
+	// Purpose is the space separated purpose list declared in the site's manifest, empty means "any"
+	Purpose string
+	// FetchedAt is when the icon was downloaded, zero for icons cached before it was recorded
+	FetchedAt time.Time
+	// Hash is the SHA-256 of the body filled by the cache, it changes when the site replaces the icon in place
+	Hash string
 }
 
 // Name returns the icon filename without path or query string
@@ -17,7 +52,7 @@ func (i Icon) Name() string {
 	return i.URL.Path
 }
 func (i Icon) Path() string {
-	pathParts := []string{"/i/", i.URL.Hostname()}
+	pathParts := []string{"/i/", SchemePathPrefix(i.URL), i.URL.Hostname()}
 	if i.URL.Port() != "" {
 		pathParts = append(pathParts, ":", i.URL.Port())
 	}
@@ -30,9 +65,203 @@ func (i Icon) Path() string {
 	return strings.Join(pathParts, "")
 }
 
+// IsVariant reports whether the icon is a generated square variant of another icon
+func (i Icon) IsVariant() bool {
+	_, _, ok := VariantOf(i.URL)
+	return ok
+}
+
+// InlineIconURL returns the stable URL of the icon embedded into the data URI, other URLs are returned as is.
+// The URL is derived from the content hash, every icon gets its own host, so icon indexes stay small.
+func InlineIconURL(u *url.URL) *url.URL {
+	if u == nil || u.Scheme != "data" {
+		return u
+	}
+
+	sum := sha256.Sum256([]byte(u.Opaque))
+
+	return &url.URL{
+		Scheme: "https",
+		Host:   hex.EncodeToString(sum[:16]) + "." + InlineIconDomain,
+		Path:   "/icon" + inlineIconExt(u.Opaque),
+	}
+}
+
+// IsInlineIconURL reports whether the URL was made by InlineIconURL, such icons can't be downloaded again
+func IsInlineIconURL(u *url.URL) bool {
+	return strings.HasSuffix(u.Hostname(), "."+InlineIconDomain)
+}
+
+func inlineIconExt(payload string) string {
+	mimeType, _, _ := strings.Cut(payload, ",")
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	switch strings.ToLower(strings.TrimSpace(mimeType)) {
+	case "image/svg+xml":
+		return ".svg"
+	case "image/png":
+		return ".png"
+	case "image/x-icon", "image/vnd.microsoft.icon":
+		return ".ico"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "image/jpeg":
+		return ".jpg"
+	}
+	return ""
+}
+
+// VariantURL returns the URL of the size x size PNG variant of the icon at u.
+// The size parameter is appended to the original query, so the source URL can be restored exactly.
+func VariantURL(u *url.URL, size int) *url.URL {
+	return appendParam(u, IconSizeParam, strconv.Itoa(size))
+}
+
+// MaskableVariantURL returns the URL of the size x size maskable PNG variant of the icon at u.
+// The icon is placed inside the safe zone on the background color, see MaskBackground.
+func MaskableVariantURL(u *url.URL, size int, background string) *url.URL {
+	return VariantURL(appendParam(u, IconMaskParam, MaskBackground(background)), size)
+}
+
+// VariantOf returns the source icon URL and the requested size if u points to a generated variant,
+// it has IconSizeParam as the last parameter with one of VariantSizes.
+// The source of a maskable variant still has the mask parameter, see MaskOf.
+func VariantOf(u *url.URL) (src *url.URL, size int, ok bool) {
+	src, value, ok := cutLastParam(u, IconSizeParam)
+	if !ok {
+		return nil, 0, false
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || !slices.Contains(VariantSizes, size) {
+		return nil, 0, false
+	}
+
+	return src, size, true
+}
+
+// MaskOf returns the source icon URL and the rrggbb background color if u is the source of a maskable variant
+func MaskOf(u *url.URL) (src *url.URL, background string, ok bool) {
+	src, background, ok = cutLastParam(u, IconMaskParam)
+	if !ok || !maskBackground.MatchString(background) {
+		return nil, "", false
+	}
+
+	return src, background, true
+}
+
+// MaskBackground converts a hex CSS color to the rrggbb form used in maskable variant URLs,
+// other colors fall back to white
+func MaskBackground(color string) string {
+	if !hexColor.MatchString(color) {
+		return defaultMaskBackground
+	}
+
+	hex := strings.ToLower(strings.TrimPrefix(color, "#"))
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	return hex
+}
+
+// ResizingSource picks the icon variants are rendered from: vector icons first, then the biggest raster one.
+// Variants and maskable-only icons are skipped, since the latter are padded for cropping.
+func ResizingSource(icons []Icon) (source Icon, found bool) {
+	var candidates []Icon
+	for _, icon := range icons {
+		if icon.URL == nil || icon.IsVariant() || !HasPurpose(icon.Purpose, PurposeAny) {
+			continue
+		}
+		if strings.Contains(icon.Props.MimeType, "svg") {
+			return icon, true
+		}
+		candidates = append(candidates, icon)
+	}
+
+	if len(candidates) == 0 {
+		return source, false
+	}
+
+	return slices.MaxFunc(candidates, func(a, b Icon) int {
+		pixelsA := a.Props.Size.Width * a.Props.Size.Height
+		pixelsB := b.Props.Size.Width * b.Props.Size.Height
+		return cmp.Compare(pixelsA, pixelsB)
+	}), true
+}
+
+// appendParam appends the parameter to the original query keeping its encoding and order
+func appendParam(u *url.URL, name, value string) *url.URL {
+	withParam := *u
+	param := name + "=" + value
+	if withParam.RawQuery != "" {
+		withParam.RawQuery += "&" + param
+	} else {
+		withParam.RawQuery = param
+	}
+	return &withParam
+}
+
+// cutLastParam removes the last query parameter if it has the name, the rest of the query is kept as is
+func cutLastParam(u *url.URL, name string) (rest *url.URL, value string, ok bool) {
+	if u == nil || u.RawQuery == "" {
+		return nil, "", false
+	}
+
+	params := strings.Split(u.RawQuery, "&")
+	paramName, value, found := strings.Cut(params[len(params)-1], "=")
+	if !found || paramName != name {
+		return nil, "", false
+	}
+
+	withoutParam := *u
+	withoutParam.RawQuery = strings.Join(params[:len(params)-1], "&")
+
+	return &withoutParam, value, true
+}
+
+// SizeAny is the sizes value of vector images which can be scaled to any size
+const SizeAny = "any"
+
 type ImageProps struct {
 	MimeType string
-	Size     ImageSize
+	// Size is the biggest size of the image, it's used to compare icons
+	Size ImageSize
+	// Sizes lists every size the image holds, e.g. frames of an ICO file, empty means just Size
+	Sizes []ImageSize `json:",omitempty"`
+	// DominantColor is the most common color of the image as #rrggbb, only the icon the theme color
+	// may be taken from is sampled
+	DominantColor string `json:",omitempty"`
+}
+
+// IsScalable reports whether the image is a vector one
+func (p ImageProps) IsScalable() bool {
+	return strings.Contains(p.MimeType, "/svg")
+}
+
+// HasSize reports whether the image holds the exact size
+func (p ImageProps) HasSize(size ImageSize) bool {
+	return p.Size == size || slices.Contains(p.Sizes, size)
+}
+
+// SizesAttr returns the value of the manifest's sizes member: "any" for vector images,
+// otherwise every size the image holds separated by spaces
+func (p ImageProps) SizesAttr() string {
+	if p.IsScalable() {
+		return SizeAny
+	}
+
+	if len(p.Sizes) == 0 {
+		return p.Size.String()
+	}
+
+	sizes := make([]string, 0, len(p.Sizes))
+	for _, size := range p.Sizes {
+		sizes = append(sizes, size.String())
+	}
+
+	return strings.Join(sizes, " ")
 }
 
 type ImageSize struct {
@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariantURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		size         int
+		expectedURL  string
+		expectedPath string
+	}{
+		{
+			name:         "no query",
+			source:       "https://example.com/favicon.ico",
+			size:         512,
+			expectedURL:  "https://example.com/favicon.ico?intopwa-size=512",
+			expectedPath: "/i/example.com/favicon.ico?intopwa-size=512",
+		},
+		{
+			name:         "query order is kept",
+			source:       "https://example.com:8080/icon.png?v=2&a=1",
+			size:         192,
+			expectedURL:  "https://example.com:8080/icon.png?v=2&a=1&intopwa-size=192",
+			expectedPath: "/i/example.com:8080/icon.png?v=2&a=1&intopwa-size=192",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, _ := url.Parse(tt.source)
+
+			variant := VariantURL(source, tt.size)
+			assert.Equal(t, tt.expectedURL, variant.String())
+			assert.Equal(t, tt.expectedPath, Icon{URL: variant}.Path())
+
+			restored, size, ok := VariantOf(variant)
+			assert.True(t, ok)
+			assert.Equal(t, tt.size, size)
+			assert.Equal(t, tt.source, restored.String())
+		})
+	}
+}
+
+func TestVariantOfIgnoresForeignSizeParam(t *testing.T) {
+	for _, rawURL := range []string{
+		"https://www.gravatar.com/avatar/abc?s=80",
+		"https://www.gravatar.com/avatar/abc?s=192",
+		"https://www.gravatar.com/avatar/abc?d=mp&s=512",
+	} {
+		u, _ := url.Parse(rawURL)
+
+		_, _, ok := VariantOf(u)
+		assert.False(t, ok, rawURL)
+		assert.False(t, Icon{URL: u}.IsVariant(), rawURL)
+	}
+}
+
+func TestMaskableVariantURL(t *testing.T) {
+	source, _ := url.Parse("https://example.com/icon.png?v=2")
+
+	variant := MaskableVariantURL(source, 512, "#3367D6")
+	assert.Equal(t, "https://example.com/icon.png?v=2&intopwa-mask=3367d6&intopwa-size=512", variant.String())
+	assert.True(t, Icon{URL: variant}.IsVariant())
+
+	masked, size, ok := VariantOf(variant)
+	assert.True(t, ok)
+	assert.Equal(t, 512, size)
+
+	restored, background, ok := MaskOf(masked)
+	assert.True(t, ok)
+	assert.Equal(t, "3367d6", background)
+	assert.Equal(t, source.String(), restored.String())
+
+	_, _, ok = MaskOf(source)
+	assert.False(t, ok)
+}
+
+func TestMaskBackground(t *testing.T) {
+	assert.Equal(t, "3367d6", MaskBackground("#3367D6"))
+	assert.Equal(t, "aabbcc", MaskBackground("#abc"))
+	assert.Equal(t, "ffffff", MaskBackground("rgb(1, 2, 3)"))
+	assert.Equal(t, "ffffff", MaskBackground(""))
+}
+
+func TestImagePropsSizesAttr(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    ImageProps
+		expected string
+	}{
+		{
+			name:     "raster",
+			props:    ImageProps{MimeType: "image/png", Size: ImageSize{Width: 192, Height: 192}},
+			expected: "192x192",
+		},
+		{
+			name: "ico frames",
+			props: ImageProps{
+				MimeType: "image/x-icon",
+				Size:     ImageSize{Width: 48, Height: 48},
+				Sizes:    []ImageSize{{Width: 48, Height: 48}, {Width: 32, Height: 32}, {Width: 16, Height: 16}},
+			},
+			expected: "48x48 32x32 16x16",
+		},
+		{
+			name:     "vector",
+			props:    ImageProps{MimeType: "image/svg+xml", Size: ImageSize{Width: 24, Height: 24}},
+			expected: "any",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.props.SizesAttr())
+		})
+	}
+}
+
+func TestInlineIconURL(t *testing.T) {
+	pngIcon := &url.URL{Scheme: "data", Opaque: "image/png;base64,iVBORw0KGgo="}
+	svgIcon := &url.URL{Scheme: "data", Opaque: "image/svg+xml,%3Csvg%3E%3C/svg%3E"}
+	remoteIcon, _ := url.Parse("https://example.com/icon.png")
+
+	inline := InlineIconURL(pngIcon)
+	assert.Equal(t, inline, InlineIconURL(pngIcon), "the URL must be stable")
+	assert.True(t, IsInlineIconURL(inline))
+	assert.Equal(t, "/icon.png", inline.Path)
+	assert.Equal(t, "/icon.svg", InlineIconURL(svgIcon).Path)
+	assert.NotEqual(t, inline.Host, InlineIconURL(svgIcon).Host)
+
+	// the stable URL survives the round trip through the /i/ path
+	roundTrip, err := url.Parse("https://" + strings.TrimPrefix(Icon{URL: inline}.Path(), "/i/"))
+	require.NoError(t, err)
+	assert.Equal(t, inline.String(), roundTrip.String())
+
+	assert.Same(t, remoteIcon, InlineIconURL(remoteIcon))
+	assert.False(t, IsInlineIconURL(remoteIcon))
+}
+
+func TestIconPathKeepsSchemeAndPort(t *testing.T) {
+	httpsIcon, _ := url.Parse("https://example.com/icon.png")
+	httpIcon, _ := url.Parse("http://intranet.local:8080/icon.png?v=1")
+
+	assert.Equal(t, "/i/example.com/icon.png", Icon{URL: httpsIcon}.Path())
+	assert.Equal(t, "/i/http/intranet.local:8080/icon.png?v=1", Icon{URL: httpIcon}.Path())
+}
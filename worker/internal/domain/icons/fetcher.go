@@ -5,40 +5,108 @@ import (
 	"context"
 	"fmt"
 	"github.com/nazar256/intopwa/internal/domain"
+	"github.com/nazar256/intopwa/internal/pkg/imaging"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"slices"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxIconDownloads caps the scraped icons downloaded for a manifest, the user's icons are always downloaded
+	maxIconDownloads = 4
+	// scalableScore ranks a vector icon above any raster one, it can be rendered in every size
+	scalableScore = 1024
+	// DefaultSoftTTL is the age cached pages and icons are refreshed after, they are served meanwhile
+	DefaultSoftTTL = 24 * time.Hour
+	// DefaultFailureTTL is how long a page failing to scrape isn't fetched again
+	DefaultFailureTTL = 10 * time.Minute
+	// refreshTimeout bounds a whole refresh, every request of it has its own timeout too.
+	// Cloudflare keeps waitUntil tasks for about as long after the response.
+	refreshTimeout = 30 * time.Second
 )
 
 type scraper interface {
-	ScrapeIconURLs(ctx context.Context, u *url.URL) ([]*url.URL, error)
+	ScrapePage(ctx context.Context, u *url.URL) (domain.Page, error)
+	// DownloadIcons may return the icons downloaded along with an error, e.g. when there are too many icons
 	DownloadIcons(ctx context.Context, iconURLs []*url.URL) (icons []domain.Icon, err error)
 }
 
 type iconsCache interface {
 	Store(icons []domain.Icon) error
 	Get(urls []*url.URL) ([]domain.Icon, bool, error)
+	GetMeta(urls []*url.URL) ([]domain.Icon, bool, error)
 }
 
 type linksCache interface {
-	GetIconURLs(u *url.URL) (urls []*url.URL, found bool, err error)
+	GetPage(u *url.URL) (page domain.Page, found bool, err error)
+	StorePage(u *url.URL, page domain.Page) error
 	StoreIconURLs(u *url.URL, iconsURLs []*url.URL) error
+	GetAlias(u *url.URL) (identity *url.URL, found bool, err error)
+	StoreAlias(u *url.URL, identity *url.URL) error
+	GetFailure(u *url.URL) (failure domain.ScrapeFailure, found bool, err error)
+	StoreFailure(u *url.URL, failure domain.ScrapeFailure) error
+	ClearFailure(u *url.URL) error
+}
+
+type settingsCache interface {
+	Get(u *url.URL) (settings domain.AppSettings, found bool, err error)
+	Store(u *url.URL, settings domain.AppSettings) error
 }
 
 type fetcher struct {
-	scraper    scraper
-	iconsCache iconsCache
-	linksCache linksCache
+	scraper       scraper
+	iconsCache    iconsCache
+	linksCache    linksCache
+	settingsCache settingsCache
+
+	softTTL    time.Duration
+	failureTTL time.Duration
+	background func(task func(ctx context.Context))
+	// refreshing holds identities of apps being refreshed, so concurrent requests don't refresh twice
+	refreshing sync.Map
 }
 
-func NewIconsFetcher(s scraper, icons iconsCache, links linksCache) *fetcher {
-	return &fetcher{
-		scraper:    s,
-		iconsCache: icons,
-		linksCache: links,
+type Option func(f *fetcher)
+
+// WithFailureTTL sets how long a page failing to scrape isn't fetched again, zero disables negative caching
+func WithFailureTTL(ttl time.Duration) Option {
+	return func(f *fetcher) {
+		f.failureTTL = ttl
+	}
+}
+
+// WithRefresh sets the age cached data is refreshed after and runs refreshes with background,
+// e.g. with waitUntil of the Cloudflare request. The context background passes cancels the refresh,
+// e.g. on shutdown. Zero softTTL disables refreshing.
+func WithRefresh(softTTL time.Duration, background func(task func(ctx context.Context))) Option {
+	return func(f *fetcher) {
+		f.softTTL = softTTL
+		f.background = background
+	}
+}
+
+func NewIconsFetcher(s scraper, icons iconsCache, links linksCache, settings settingsCache, opts ...Option) *fetcher {
+	f := &fetcher{
+		scraper:       s,
+		iconsCache:    icons,
+		linksCache:    links,
+		settingsCache: settings,
+		softTTL:       DefaultSoftTTL,
+		failureTTL:    DefaultFailureTTL,
+		background: func(task func(ctx context.Context)) {
+			go task(context.Background())
+		},
+	}
+
+	for _, opt := range opts {
+		opt(f)
 	}
+
+	return f
 }
 
 func (f *fetcher) CacheIcons(ctx context.Context, pageURL *url.URL, iconURLs []*url.URL) (err error) {
@@ -46,7 +114,9 @@ func (f *fetcher) CacheIcons(ctx context.Context, pageURL *url.URL, iconURLs []*
 		return nil
 	}
 
-	icons, err := f.scraper.DownloadIcons(ctx, iconURLs)
+	pageURL = f.appIdentity(domain.CleanAppURL(pageURL))
+
+	icons, err := f.downloadIcons(ctx, iconURLs)
 	if err != nil {
 		return fmt.Errorf("failed to download icons: %w", err)
 	}
@@ -69,52 +139,315 @@ func (f *fetcher) CacheIcons(ctx context.Context, pageURL *url.URL, iconURLs []*
 	return nil
 }
 
-func (f *fetcher) FetchIcons(ctx context.Context, u *url.URL) []domain.Icon {
-	iconURLs, iconsURLsFound, err := f.linksCache.GetIconURLs(u)
+// StoreSettings persists the user's manifest overrides of the app
+func (f *fetcher) StoreSettings(u *url.URL, settings domain.AppSettings) error {
+	err := f.settingsCache.Store(f.appIdentity(domain.CleanAppURL(u)), settings)
 	if err != nil {
-		slog.Error("failed to read icon URLs from cache", "err", err)
-		return nil
+		return fmt.Errorf("failed to store app settings: %w", err)
 	}
 
-	if !iconsURLsFound {
-		iconURLs, err = f.scraper.ScrapeIconURLs(ctx, u)
+	return nil
+}
+
+// FetchApp returns the app's icons along with the data scraped from the app's page.
+// Aliases of the app, e.g. URLs redirecting to it or with tracking parameters, share its cache entries.
+func (f *fetcher) FetchApp(ctx context.Context, u *url.URL) (app domain.App) {
+	u = domain.CleanAppURL(u)
+	identity := f.appIdentity(u)
+	app.Identity = identity
+
+	page, pageFound, err := f.linksCache.GetPage(identity)
+	// data cached past the soft TTL is served, but refreshed in the background
+	stale := pageFound && f.isStale(page.FetchedAt)
+	if err != nil {
+		slog.Error("failed to read page from cache", "err", err)
+		app.Settings = f.appSettings(identity, u)
+		return app
+	}
+
+	if !pageFound {
+		if failure, failed := f.recentFailure(u); failed {
+			slog.Info("page failed to scrape recently", "URL", u.String(), "reason", failure.Reason, "err", failure.Message)
+			app.Failure = &failure
+			app.Settings = f.appSettings(identity, u)
+			return app
+		}
+
+		page, err = f.scraper.ScrapePage(ctx, u)
 		if err != nil {
-			slog.Error("failed to scrape icon URLs", "err", err)
-			return nil
+			slog.Error("failed to scrape page", "err", err)
+			app.Failure = f.storeFailure(ctx, u, err)
+			app.Settings = f.appSettings(identity, u)
+			return app
+		}
+
+		identity = page.Identity(u)
+		app.Identity = identity
+		if identity.String() != u.String() {
+			err = f.linksCache.StoreAlias(u, identity)
+			if err != nil {
+				slog.Error("failed to store app alias", "err", err)
+			}
 		}
 
-		err = f.linksCache.StoreIconURLs(u, iconURLs)
+		err = f.linksCache.StorePage(identity, page)
 		if err != nil {
-			slog.Error("failed to store icon URLs", "err", err)
-			return nil
+			slog.Error("failed to store page", "err", err)
+			app.Settings = f.appSettings(identity, u)
+			return app
 		}
 	}
 
+	app.Settings = f.appSettings(identity, u)
+	defer func() {
+		if stale {
+			f.refresh(identity, page)
+		}
+	}()
+
+	app.Manifest = page.Manifest
+	app.Metadata = page.Metadata
+	app.IconLinks = page.IconCandidates()
+
+	iconURLs := selectIconURLs(app.IconLinks)
 	if len(iconURLs) == 0 {
-		return nil
+		return app
 	}
 
-	icons, iconsFound, err := f.iconsCache.Get(iconURLs)
+	// manifest only needs icon props, so bodies are not read from the blob storage
+	icons, iconsFound, err := f.iconsCache.GetMeta(cachedIconURLs(iconURLs))
 	if err != nil {
 		slog.Error("failed to read icons from cache", "err", err)
-		return nil
+		return app
 	}
 
 	if !iconsFound {
-		icons, err = f.scraper.DownloadIcons(ctx, iconURLs)
+		icons, err = f.downloadIcons(ctx, iconURLs)
 		if err != nil {
 			slog.Error("failed to download icons", "err", err)
-			return icons
+			app.Icons = withDeclaredPurposes(icons, page.Manifest)
+			return app
+		}
+
+		if page.Metadata.ThemeColor == "" {
+			icons = f.withDominantColor(icons)
 		}
 
 		err = f.iconsCache.Store(icons)
 		if err != nil {
 			slog.Error("failed to store icons in cache", "err", err)
+			app.Icons = withDeclaredPurposes(icons, page.Manifest)
+			return app
+		}
+	} else {
+		for _, icon := range icons {
+			stale = stale || f.isStale(icon.FetchedAt)
+		}
+
+		if page.Metadata.ThemeColor == "" {
+			icons = f.withDominantColor(icons)
+		}
+	}
+
+	app.Icons = ensureVariants(withDeclaredPurposes(icons, page.Manifest))
+
+	return app
+}
+
+// ForgetFailure drops the cached failure of scraping the page, so the next request retries it
+func (f *fetcher) ForgetFailure(u *url.URL) error {
+	err := f.linksCache.ClearFailure(domain.CleanAppURL(u))
+	if err != nil {
+		return fmt.Errorf("failed to clear scrape failure: %w", err)
+	}
+
+	return nil
+}
+
+// recentFailure returns the failure of scraping the page within the failure TTL
+func (f *fetcher) recentFailure(u *url.URL) (domain.ScrapeFailure, bool) {
+	if f.failureTTL <= 0 {
+		return domain.ScrapeFailure{}, false
+	}
+
+	failure, found, err := f.linksCache.GetFailure(u)
+	if err != nil {
+		slog.Error("failed to read scrape failure", "err", err)
+		return failure, false
+	}
+
+	return failure, found && time.Since(failure.FailedAt) < f.failureTTL
+}
+
+// storeFailure caches the reason the page failed to scrape and returns it,
+// requests cancelled by the client aren't the site's fault, so they aren't cached
+func (f *fetcher) storeFailure(ctx context.Context, u *url.URL, scrapeErr error) *domain.ScrapeFailure {
+	failure := domain.FailureOf(scrapeErr)
+	failure.FailedAt = time.Now()
+
+	if f.failureTTL <= 0 || ctx.Err() != nil {
+		return &failure
+	}
+
+	err := f.linksCache.StoreFailure(u, failure)
+	if err != nil {
+		slog.Error("failed to store scrape failure", "err", err)
+	}
+
+	return &failure
+}
+
+// isStale tells whether data fetched at the time is past the soft TTL, data cached without the time is stale
+func (f *fetcher) isStale(fetchedAt time.Time) bool {
+	return f.softTTL > 0 && time.Since(fetchedAt) > f.softTTL
+}
+
+// refresh scrapes the app's page again and downloads its icons in the background, the next requests get
+// the fresh data. The user's icons are kept.
+func (f *fetcher) refresh(identity *url.URL, cached domain.Page) {
+	key := identity.String()
+	if _, running := f.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	// the request is over by the time the refresh runs, so its context can't be used
+	f.background(func(ctx context.Context) {
+		defer f.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		defer cancel()
+
+		page, err := f.scraper.ScrapePage(ctx, identity)
+		if err != nil {
+			slog.Error("failed to refresh page", "err", err, "URL", key)
+			return
+		}
+
+		if slices.ContainsFunc(cached.IconLinks, func(link domain.IconLink) bool {
+			return link.Rel == domain.RelCustom
+		}) {
+			page.IconLinks = cached.IconLinks
+		}
+		page.FetchedAt = time.Now()
+
+		err = f.linksCache.StorePage(identity, page)
+		if err != nil {
+			slog.Error("failed to store refreshed page", "err", err, "URL", key)
+			return
+		}
+
+		iconURLs := selectIconURLs(page.IconCandidates())
+		if len(iconURLs) == 0 {
+			return
+		}
+
+		icons, err := f.downloadIcons(ctx, iconURLs)
+		if err != nil {
+			slog.Error("failed to refresh icons", "err", err, "URL", key)
+			return
+		}
+
+		err = f.iconsCache.Store(icons)
+		if err != nil {
+			slog.Error("failed to store refreshed icons", "err", err, "URL", key)
+		}
+	})
+}
+
+// withDominantColor colors the biggest icon, the manifest takes the theme color from it when the page declares none.
+// Icons read without bodies get the body from the cache, the color is cached along with the icon.
+func (f *fetcher) withDominantColor(icons []domain.Icon) []domain.Icon {
+	if len(icons) == 0 {
+		return icons
+	}
+
+	// the manifest lists the biggest icon first, ties are broken by URL the same way
+	i := 0
+	for j, icon := range icons[1:] {
+		if biggerIcon(icon, icons[i]) {
+			i = j + 1
+		}
+	}
+	icon := icons[i]
+	if icon.Props.DominantColor != "" {
+		return icons
+	}
+
+	cached := len(icon.Body) == 0
+	if cached {
+		withBody, found, err := f.iconsCache.Get([]*url.URL{icon.URL})
+		if err != nil || !found || len(withBody) == 0 {
+			slog.Error("failed to read icon to sample its color", "err", err, "URL", icon.URL.String())
 			return icons
 		}
+		icon.Body = withBody[0].Body
+	}
+
+	color, err := imaging.IconColor(icon.Body, icon.Props.MimeType)
+	if err != nil {
+		slog.Warn("failed to sample icon color", "err", err, "URL", icon.URL.String())
+		return icons
+	}
+	icons[i].Props.DominantColor = color
+
+	if cached {
+		icon.Props.DominantColor = color
+		err = f.iconsCache.Store([]domain.Icon{icon})
+		if err != nil {
+			slog.Error("failed to store icon color", "err", err, "URL", icon.URL.String())
+		}
+	}
+
+	return icons
+}
+
+// biggerIcon tells whether a goes before b in the manifest, which lists the biggest icons first
+func biggerIcon(a, b domain.Icon) bool {
+	if c := cmp.Compare(a.Props.Size.Width*a.Props.Size.Height, b.Props.Size.Width*b.Props.Size.Height); c != 0 {
+		return c > 0
 	}
+	return a.URL.String() < b.URL.String()
+}
 
-	return ensureBigIcon(icons)
+// downloadIcons keeps the icons downloaded despite an error, e.g. the ones within the limit of icons per page
+func (f *fetcher) downloadIcons(ctx context.Context, iconURLs []*url.URL) ([]domain.Icon, error) {
+	icons, err := f.scraper.DownloadIcons(ctx, iconURLs)
+	if err != nil && len(icons) > 0 {
+		slog.Warn("some icons were not downloaded", "err", err)
+		return icons, nil
+	}
+	return icons, err
+}
+
+// appIdentity returns the URL identifying the app the cleaned URL belongs to
+func (f *fetcher) appIdentity(u *url.URL) *url.URL {
+	identity, found, err := f.linksCache.GetAlias(u)
+	if err != nil {
+		slog.Error("failed to read app alias", "err", err)
+		return u
+	}
+	if !found {
+		return u
+	}
+	return identity
+}
+
+// appSettings returns the user's overrides of the app, settings stored before the app identity was known
+// are kept under the requested URL
+func (f *fetcher) appSettings(identity, u *url.URL) domain.AppSettings {
+	settings, found, err := f.settingsCache.Get(identity)
+	if err != nil {
+		slog.Error("failed to read app settings", "err", err)
+	}
+	if found || identity.String() == u.String() {
+		return settings
+	}
+
+	settings, _, err = f.settingsCache.Get(u)
+	if err != nil {
+		slog.Error("failed to read app settings", "err", err)
+	}
+	return settings
 }
 
 func (f *fetcher) One(ctx context.Context, iconURL *url.URL) (domain.Icon, error) {
@@ -123,8 +456,23 @@ func (f *fetcher) One(ctx context.Context, iconURL *url.URL) (domain.Icon, error
 		return domain.Icon{}, fmt.Errorf("failed to read icon from iconsCache: %w", err)
 	}
 
+	if sourceURL, size, isVariant := domain.VariantOf(iconURL); isVariant {
+		if !found || len(icons) == 0 {
+			return f.renderVariant(ctx, iconURL, sourceURL, size)
+		}
+
+		// stale variants are rendered again, so they follow refreshes of the source icon
+		if f.isStale(icons[0].FetchedAt) {
+			variant, err := f.renderVariant(ctx, iconURL, sourceURL, size)
+			if err == nil {
+				return variant, nil
+			}
+			slog.Error("failed to render stale icon variant", "err", err, "URL", iconURL.String())
+		}
+	}
+
 	if !found {
-		icons, err = f.scraper.DownloadIcons(ctx, []*url.URL{iconURL})
+		icons, err = f.downloadIcons(ctx, []*url.URL{iconURL})
 		if err != nil {
 			return domain.Icon{}, fmt.Errorf("failed to download Icon: %w", err)
 		}
@@ -143,7 +491,54 @@ func (f *fetcher) One(ctx context.Context, iconURL *url.URL) (domain.Icon, error
 	return icons[0], nil
 }
 
-func ensureBigIcon(icons []domain.Icon) []domain.Icon {
+// renderVariant rasterizes the source icon into a square PNG and caches the result under the variant URL.
+// Maskable variants are padded into the safe zone on the background color from the URL.
+func (f *fetcher) renderVariant(ctx context.Context, variantURL, sourceURL *url.URL, size int) (domain.Icon, error) {
+	maskSourceURL, background, maskable := domain.MaskOf(sourceURL)
+	if maskable {
+		sourceURL = maskSourceURL
+	}
+
+	source, err := f.One(ctx, sourceURL)
+	if err != nil {
+		return domain.Icon{}, fmt.Errorf("failed to fetch source icon: %w", err)
+	}
+
+	if len(source.Body) == 0 {
+		return domain.Icon{}, fmt.Errorf("source icon is empty: %s", sourceURL.String())
+	}
+
+	var body []byte
+	if maskable {
+		backgroundColor, _ := imaging.ParseHex(background)
+		body, err = imaging.Maskable(source.Body, source.Props.MimeType, size, backgroundColor)
+	} else {
+		body, err = imaging.Resize(source.Body, source.Props.MimeType, size)
+	}
+	if err != nil {
+		return domain.Icon{}, fmt.Errorf("failed to resize icon: %w", err)
+	}
+
+	variant := domain.Icon{
+		URL:  variantURL,
+		Body: body,
+		Props: domain.ImageProps{
+			MimeType: imaging.PNGMimeType,
+			Size:     domain.ImageSize{Width: size, Height: size},
+		},
+	}
+
+	err = f.iconsCache.Store([]domain.Icon{variant})
+	if err != nil {
+		slog.Error("failed to store icon variant", "err", err, "URL", variantURL.String())
+	}
+
+	return variant, nil
+}
+
+// ensureVariants adds square PNG variants for every size from domain.VariantSizes the site doesn't provide.
+// Variants are rendered lazily when requested, so only their URLs and props are filled here.
+func ensureVariants(icons []domain.Icon) []domain.Icon {
 	if len(icons) == 0 {
 		return icons
 	}
@@ -153,60 +548,157 @@ func ensureBigIcon(icons []domain.Icon) []domain.Icon {
 		normalized = append(normalized, normalizeIcon(icon))
 	}
 
-	if containsExactSizeIcon(normalized, 512, 512) {
+	source, found := domain.ResizingSource(normalized)
+	if !found {
 		return normalized
 	}
 
-	resizingCandidate := normalizeIcon(pickResizingCandidate(normalized))
+	for _, size := range domain.VariantSizes {
+		if containsExactSizeIcon(normalized, size, size, domain.PurposeAny) {
+			continue
+		}
 
-	return append(normalized, domain.Icon{
-		URL:  resizingCandidate.URL,
-		Body: resizingCandidate.Body,
-		Props: domain.ImageProps{
-			MimeType: resizingCandidate.Props.MimeType,
-			Size: domain.ImageSize{
-				Width:  512,
-				Height: 512,
+		normalized = append(normalized, domain.Icon{
+			URL: domain.VariantURL(source.URL, size),
+			Props: domain.ImageProps{
+				MimeType: imaging.PNGMimeType,
+				Size: domain.ImageSize{
+					Width:  size,
+					Height: size,
+				},
 			},
-		},
+		})
+	}
+
+	return normalized
+}
+
+// selectIconURLs picks the icons worth downloading by their declared attributes: the user's icons,
+// the biggest raster icons and at most one vector icon
+func selectIconURLs(links []domain.IconLink) []*url.URL {
+	var urls []*url.URL
+	var candidates []domain.IconLink
+	for _, link := range links {
+		if link.Rel == domain.RelCustom {
+			urls = append(urls, link.URL)
+			continue
+		}
+		candidates = append(candidates, link)
+	}
+
+	slices.SortStableFunc(candidates, func(a, b domain.IconLink) int {
+		return iconScore(b) - iconScore(a)
 	})
+
+	var selected int
+	var hasScalable bool
+	for _, link := range candidates {
+		if selected == maxIconDownloads {
+			break
+		}
+		if link.IsScalable() {
+			if hasScalable {
+				continue
+			}
+			hasScalable = true
+		}
+		urls = append(urls, link.URL)
+		selected++
+	}
+
+	return urls
 }
 
-func normalizeIcon(icon domain.Icon) domain.Icon {
-	if icon.Props.MimeType == "" && len(icon.Body) > 0 {
-		icon.Props.MimeType = http.DetectContentType(icon.Body)
+// cachedIconURLs returns URLs the icons are cached under, inline icons are cached under their stable URLs
+func cachedIconURLs(urls []*url.URL) []*url.URL {
+	cached := make([]*url.URL, 0, len(urls))
+	for _, u := range urls {
+		cached = append(cached, domain.InlineIconURL(u))
 	}
-	return icon
+	return cached
 }
 
-func containsExactSizeIcon(icons []domain.Icon, width, height int) bool {
-	for _, icon := range icons {
-		if icon.Props.Size.Width == width && icon.Props.Size.Height == height {
-			return true
+// iconScore estimates how useful the icon is for the manifest before downloading it
+func iconScore(link domain.IconLink) int {
+	score := link.MaxSize()
+	if link.IsScalable() {
+		score = scalableScore
+	} else if score == 0 {
+		switch {
+		case strings.Contains(link.Rel, "apple-touch-icon"):
+			// apple touch icons are 180x180 unless declared otherwise
+			score = 180
+		case link.Rel == domain.RelManifest:
+			score = 96
+		case link.Rel != "":
+			score = 32
+		default:
+			// well-known locations are only guesses
+			score = 16
 		}
 	}
-	return false
+
+	purposes := strings.Fields(link.Purpose)
+	switch {
+	case len(purposes) == 0 || slices.Contains(purposes, domain.PurposeAny):
+	case slices.Contains(purposes, domain.PurposeMaskable):
+		score /= 2
+	default:
+		score /= 4
+	}
+
+	// media specific icons, e.g. for the dark color scheme, don't suit every device
+	if link.Media != "" {
+		score /= 2
+	}
+
+	return score
 }
 
-func pickResizingCandidate(icons []domain.Icon) (candidate domain.Icon) {
-	if len(icons) == 0 {
-		return
+// withDeclaredPurposes sets purposes the site's manifest declares for its icons
+func withDeclaredPurposes(icons []domain.Icon, manifest *domain.WebManifest) []domain.Icon {
+	if manifest == nil {
+		return icons
 	}
 
-	for _, icon := range icons {
-		if strings.Contains(icon.Props.MimeType, "svg") {
-			return icon
+	for i, icon := range icons {
+		var purposes []string
+		for _, link := range manifest.Icons {
+			if domain.InlineIconURL(link.URL).String() != icon.URL.String() {
+				continue
+			}
+			purpose := link.Purpose
+			if purpose == "" {
+				purpose = domain.PurposeAny
+			}
+			for _, p := range strings.Fields(purpose) {
+				// unknown purposes are dropped, browsers ignore icons with only unknown ones
+				if slices.Contains(domain.Purposes, p) && !slices.Contains(purposes, p) {
+					purposes = append(purposes, p)
+				}
+			}
 		}
+		icons[i].Purpose = strings.Join(purposes, " ")
 	}
 
-	iconsToSort := make([]domain.Icon, len(icons))
-	copy(iconsToSort, icons)
+	return icons
+}
 
-	slices.SortFunc(iconsToSort, func(a, b domain.Icon) int {
-		pixelsA := a.Props.Size.Width * a.Props.Size.Height
-		pixelsB := b.Props.Size.Width * b.Props.Size.Height
-		return cmp.Compare(pixelsA, pixelsB)
-	})
+func normalizeIcon(icon domain.Icon) domain.Icon {
+	if icon.Props.MimeType == "" && len(icon.Body) > 0 {
+		icon.Props.MimeType = http.DetectContentType(icon.Body)
+	}
+	return icon
+}
 
-	return iconsToSort[0]
+func containsExactSizeIcon(icons []domain.Icon, width, height int, purpose string) bool {
+	for _, icon := range icons {
+		if !domain.HasPurpose(icon.Purpose, purpose) {
+			continue
+		}
+		if icon.Props.HasSize(domain.ImageSize{Width: width, Height: height}) {
+			return true
+		}
+	}
+	return false
 }
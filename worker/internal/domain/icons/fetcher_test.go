@@ -0,0 +1,445 @@
+package icons
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
+	cache_icons "github.com/nazar256/intopwa/internal/pkg/caching/icons"
+	"github.com/nazar256/intopwa/internal/pkg/caching/links"
+	"github.com/nazar256/intopwa/internal/pkg/caching/settings"
+	"github.com/nazar256/intopwa/internal/pkg/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEnsureVariants(t *testing.T) {
+	favicon, _ := url.Parse("https://example.com/favicon.ico")
+	touchIcon, _ := url.Parse("https://example.com/apple-touch-icon.png")
+	svgIcon, _ := url.Parse("https://example.com/icon.svg")
+	bigIcon, _ := url.Parse("https://example.com/icon-512.png")
+
+	icon := func(u *url.URL, mimeType string, size int) domain.Icon {
+		return domain.Icon{
+			URL: u,
+			Props: domain.ImageProps{
+				MimeType: mimeType,
+				Size:     domain.ImageSize{Width: size, Height: size},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		icons         []domain.Icon
+		expectedPaths []string
+	}{
+		{
+			name:  "no icons",
+			icons: nil,
+		},
+		{
+			name: "biggest raster icon is resized",
+			icons: []domain.Icon{
+				icon(favicon, "image/x-icon", 32),
+				icon(touchIcon, "image/png", 180),
+			},
+			expectedPaths: []string{
+				"/i/example.com/favicon.ico",
+				"/i/example.com/apple-touch-icon.png",
+				"/i/example.com/apple-touch-icon.png?intopwa-size=192",
+				"/i/example.com/apple-touch-icon.png?intopwa-size=512",
+			},
+		},
+		{
+			name: "svg is preferred",
+			icons: []domain.Icon{
+				icon(touchIcon, "image/png", 180),
+				icon(svgIcon, "image/svg+xml", 24),
+			},
+			expectedPaths: []string{
+				"/i/example.com/apple-touch-icon.png",
+				"/i/example.com/icon.svg",
+				"/i/example.com/icon.svg?intopwa-size=192",
+				"/i/example.com/icon.svg?intopwa-size=512",
+			},
+		},
+		{
+			name: "existing sizes are kept",
+			icons: []domain.Icon{
+				icon(bigIcon, "image/png", 512),
+			},
+			expectedPaths: []string{
+				"/i/example.com/icon-512.png",
+				"/i/example.com/icon-512.png?intopwa-size=192",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, i := range ensureVariants(tt.icons) {
+				paths = append(paths, i.Path())
+			}
+
+			assert.Equal(t, tt.expectedPaths, paths)
+		})
+	}
+}
+
+func TestSelectIconURLs(t *testing.T) {
+	link := func(path, rel, sizes, typ string) domain.IconLink {
+		u, _ := url.Parse("https://example.com" + path)
+		return domain.IconLink{URL: u, Rel: rel, Sizes: sizes, Type: typ}
+	}
+
+	darkIcon := link("/icon-dark-512.png", "icon", "512x512", "image/png")
+	darkIcon.Media = "(prefers-color-scheme: dark)"
+	maskableIcon := link("/maskable-512.png", domain.RelManifest, "512x512", "image/png")
+	maskableIcon.Purpose = domain.PurposeMaskable
+	monochromeIcon := link("/monochrome.svg", domain.RelManifest, "any", "image/svg+xml")
+	monochromeIcon.Purpose = domain.PurposeMonochrome
+
+	tests := []struct {
+		name          string
+		links         []domain.IconLink
+		expectedPaths []string
+	}{
+		{
+			name: "well-known locations only",
+			links: []domain.IconLink{
+				link("/favicon.ico", "", "", ""),
+				link("/favicon.svg", "", "", ""),
+			},
+			expectedPaths: []string{"/favicon.svg", "/favicon.ico"},
+		},
+		{
+			name: "biggest icons and one svg",
+			links: []domain.IconLink{
+				link("/favicon.ico", "", "", ""),
+				link("/favicon-16.png", "icon", "16x16", "image/png"),
+				link("/favicon-32.png", "icon", "32x32", "image/png"),
+				link("/icon.svg", "icon", "", "image/svg+xml"),
+				link("/mask.svg", "mask-icon", "", ""),
+				link("/apple-touch-icon.png", "apple-touch-icon", "", ""),
+				link("/icon-192.png", domain.RelManifest, "192x192", "image/png"),
+				link("/icon-512.png", domain.RelManifest, "512x512", "image/png"),
+			},
+			expectedPaths: []string{"/icon.svg", "/icon-512.png", "/icon-192.png", "/apple-touch-icon.png"},
+		},
+		{
+			name: "purpose and media specific icons are ranked lower",
+			links: []domain.IconLink{
+				maskableIcon,
+				darkIcon,
+				monochromeIcon,
+				link("/icon-300.png", "icon", "300x300", "image/png"),
+				link("/icon-384.png", domain.RelManifest, "384x384", "image/png"),
+			},
+			expectedPaths: []string{"/icon-384.png", "/icon-300.png", "/maskable-512.png", "/icon-dark-512.png"},
+		},
+		{
+			name: "user icons are always downloaded",
+			links: []domain.IconLink{
+				link("/custom-1.png", domain.RelCustom, "", ""),
+				link("/custom-2.png", domain.RelCustom, "", ""),
+				link("/custom-3.png", domain.RelCustom, "", ""),
+				link("/custom-4.png", domain.RelCustom, "", ""),
+				link("/custom-5.png", domain.RelCustom, "", ""),
+			},
+			expectedPaths: []string{"/custom-1.png", "/custom-2.png", "/custom-3.png", "/custom-4.png", "/custom-5.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, u := range selectIconURLs(tt.links) {
+				paths = append(paths, u.Path)
+			}
+			assert.Equal(t, tt.expectedPaths, paths)
+		})
+	}
+}
+
+func TestFetchAppSharesCacheAcrossAliases(t *testing.T) {
+	scraper := &pageScraper{page: func(u *url.URL) domain.Page {
+		final, _ := url.Parse("https://www.example.com/")
+		canonical, _ := url.Parse("https://example.com/")
+		return domain.Page{
+			URL:          final,
+			CanonicalURL: canonical,
+			Metadata:     domain.PageMetadata{Title: "Example"},
+		}
+	}}
+	linksCache := links.NewCache(newMemKV(), newMemKV())
+	settingsCache := settings.NewCache(newMemKV())
+	f := NewIconsFetcher(scraper, noIcons{}, linksCache, settingsCache)
+
+	aliases := []string{
+		"https://www.example.com/?utm_source=newsletter",
+		"https://WWW.example.com/",
+		"https://example.com/",
+	}
+
+	for _, alias := range aliases {
+		u, _ := url.Parse(alias)
+		app := f.FetchApp(context.Background(), u)
+		assert.Equal(t, "Example", app.Metadata.Title, alias)
+		assert.Equal(t, "https://example.com/", app.Identity.String(), alias)
+	}
+	// the page is scraped once and cached under the canonical URL
+	assert.Equal(t, 1, scraper.calls)
+
+	identity, found, err := linksCache.GetAlias(&url.URL{Scheme: "https", Host: "www.example.com", Path: "/"})
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "https://example.com/", identity.String())
+
+	// settings stored for an alias belong to the app identity
+	u, _ := url.Parse("https://www.example.com/?fbclid=1")
+	err = f.StoreSettings(u, domain.AppSettings{Name: "Mine"})
+	require.NoError(t, err)
+
+	canonical, _ := url.Parse("https://example.com/")
+	assert.Equal(t, "Mine", f.FetchApp(context.Background(), canonical).Settings.Name)
+}
+
+func TestFetchAppRefreshesStalePage(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	scraper := &pageScraper{}
+	scraper.page = func(*url.URL) domain.Page {
+		return domain.Page{
+			URL:      u,
+			Metadata: domain.PageMetadata{Title: fmt.Sprintf("Example %d", scraper.calls)},
+		}
+	}
+	linksCache := links.NewCache(newMemKV(), newMemKV())
+	var refreshes int
+	f := NewIconsFetcher(scraper, noIcons{}, linksCache, settings.NewCache(newMemKV()),
+		WithRefresh(time.Hour, func(task func(ctx context.Context)) {
+			refreshes++
+			task(context.Background())
+		}),
+	)
+
+	assert.Equal(t, "Example 1", f.FetchApp(context.Background(), u).Metadata.Title)
+	assert.Equal(t, "Example 1", f.FetchApp(context.Background(), u).Metadata.Title)
+	assert.Equal(t, 0, refreshes)
+
+	page, _, err := linksCache.GetPage(u)
+	require.NoError(t, err)
+	page.FetchedAt = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, linksCache.StorePage(u, page))
+
+	// the stale page is served while the refresh stores the new one
+	assert.Equal(t, "Example 1", f.FetchApp(context.Background(), u).Metadata.Title)
+	assert.Equal(t, 1, refreshes)
+	// the refresh outlives the request, but not for longer than its own timeout
+	assert.WithinDuration(t, time.Now().Add(refreshTimeout), scraper.deadline, time.Second)
+	assert.Equal(t, "Example 2", f.FetchApp(context.Background(), u).Metadata.Title)
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 2, scraper.calls)
+}
+
+func TestFetchAppCachesScrapeFailures(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	scraper := &pageScraper{
+		page: func(*url.URL) domain.Page {
+			return domain.Page{URL: u, Metadata: domain.PageMetadata{Title: "Example"}}
+		},
+		err: fmt.Errorf("failed to fetch page: %w", &domain.ScrapeFailure{Reason: domain.FailureStatus, Status: 503}),
+	}
+	linksCache := links.NewCache(newMemKV(), newMemKV())
+	f := NewIconsFetcher(scraper, noIcons{}, linksCache, settings.NewCache(newMemKV()))
+
+	f.FetchApp(context.Background(), u)
+	app := f.FetchApp(context.Background(), u)
+	assert.Equal(t, 1, scraper.calls)
+	if assert.NotNil(t, app.Failure) {
+		assert.Equal(t, 503, app.Failure.Status)
+	}
+
+	failure, found, err := linksCache.GetFailure(u)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, domain.FailureStatus, failure.Reason)
+	assert.Equal(t, 503, failure.Status)
+
+	// the site is fixed and the user asks to retry
+	scraper.err = nil
+	require.NoError(t, f.ForgetFailure(u))
+	assert.Equal(t, "Example", f.FetchApp(context.Background(), u).Metadata.Title)
+	assert.Equal(t, 2, scraper.calls)
+}
+
+func TestFetchAppSamplesColorOfBiggestIcon(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	smallURL, _ := url.Parse("https://example.com/small.png")
+	bigURL, _ := url.Parse("https://example.com/big.png")
+	downloaded := []domain.Icon{
+		solidIcon(t, smallURL, 32, color.NRGBA{R: 0xff, A: 0xff}),
+		solidIcon(t, bigURL, 192, color.NRGBA{B: 0xff, A: 0xff}),
+	}
+	page := func(themeColor string) func(*url.URL) domain.Page {
+		return func(*url.URL) domain.Page {
+			return domain.Page{
+				URL: u,
+				IconLinks: []domain.IconLink{
+					{URL: smallURL, Rel: "icon", Sizes: "32x32"},
+					{URL: bigURL, Rel: "icon", Sizes: "192x192"},
+				},
+				Metadata: domain.PageMetadata{ThemeColor: themeColor},
+			}
+		}
+	}
+	colors := func(icons []domain.Icon) map[string]string {
+		byURL := map[string]string{}
+		for _, icon := range icons {
+			if !icon.IsVariant() {
+				byURL[icon.URL.String()] = icon.Props.DominantColor
+			}
+		}
+		return byURL
+	}
+
+	t.Run("downloaded icons", func(t *testing.T) {
+		iconsCache := cache_icons.NewCache(newMemKV(), newMemBlobs())
+		scraper := &pageScraper{page: page(""), icons: slices.Clone(downloaded)}
+		f := NewIconsFetcher(scraper, iconsCache, links.NewCache(newMemKV(), newMemKV()), settings.NewCache(newMemKV()))
+
+		app := f.FetchApp(context.Background(), u)
+		assert.Equal(t, map[string]string{bigURL.String(): "#0000ff", smallURL.String(): ""}, colors(app.Icons))
+
+		cached, _, err := iconsCache.GetMeta([]*url.URL{bigURL})
+		require.NoError(t, err)
+		require.Len(t, cached, 1)
+		assert.Equal(t, "#0000ff", cached[0].Props.DominantColor)
+	})
+
+	t.Run("cached icons", func(t *testing.T) {
+		iconsCache := cache_icons.NewCache(newMemKV(), newMemBlobs())
+		require.NoError(t, iconsCache.Store(slices.Clone(downloaded)))
+		scraper := &pageScraper{page: page("")}
+		f := NewIconsFetcher(scraper, iconsCache, links.NewCache(newMemKV(), newMemKV()), settings.NewCache(newMemKV()))
+
+		app := f.FetchApp(context.Background(), u)
+		assert.Equal(t, map[string]string{bigURL.String(): "#0000ff", smallURL.String(): ""}, colors(app.Icons))
+
+		// the color is cached, so the icon isn't decoded again
+		cached, _, err := iconsCache.GetMeta([]*url.URL{bigURL})
+		require.NoError(t, err)
+		require.Len(t, cached, 1)
+		assert.Equal(t, "#0000ff", cached[0].Props.DominantColor)
+	})
+
+	t.Run("page theme color", func(t *testing.T) {
+		iconsCache := cache_icons.NewCache(newMemKV(), newMemBlobs())
+		scraper := &pageScraper{page: page("#123456"), icons: slices.Clone(downloaded)}
+		f := NewIconsFetcher(scraper, iconsCache, links.NewCache(newMemKV(), newMemKV()), settings.NewCache(newMemKV()))
+
+		app := f.FetchApp(context.Background(), u)
+		assert.Equal(t, map[string]string{bigURL.String(): "", smallURL.String(): ""}, colors(app.Icons))
+	})
+}
+
+// solidIcon is a downloaded square PNG icon of the color
+func solidIcon(t *testing.T, u *url.URL, size int, c color.NRGBA) domain.Icon {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	body, err := imaging.EncodePNG(img)
+	require.NoError(t, err)
+
+	return domain.Icon{
+		URL:  u,
+		Body: body,
+		Props: domain.ImageProps{
+			MimeType: imaging.PNGMimeType,
+			Size:     domain.ImageSize{Width: size, Height: size},
+		},
+	}
+}
+
+type pageScraper struct {
+	page  func(u *url.URL) domain.Page
+	icons []domain.Icon
+	err   error
+	calls int
+	// deadline is the deadline of the last scrape, if any
+	deadline time.Time
+}
+
+func (s *pageScraper) ScrapePage(ctx context.Context, u *url.URL) (domain.Page, error) {
+	s.calls++
+	s.deadline, _ = ctx.Deadline()
+	if s.err != nil {
+		return domain.Page{}, s.err
+	}
+	return s.page(u), nil
+}
+
+func (s *pageScraper) DownloadIcons(context.Context, []*url.URL) ([]domain.Icon, error) {
+	return s.icons, nil
+}
+
+type noIcons struct{}
+
+func (noIcons) Store([]domain.Icon) error                       { return nil }
+func (noIcons) Get([]*url.URL) ([]domain.Icon, bool, error)     { return nil, false, nil }
+func (noIcons) GetMeta([]*url.URL) ([]domain.Icon, bool, error) { return nil, false, nil }
+
+type memKV struct {
+	data map[string][]byte
+}
+
+func newMemKV() *memKV {
+	return &memKV{data: make(map[string][]byte)}
+}
+
+func (m *memKV) Get(key string) ([]byte, error) {
+	return m.data[key], nil
+}
+
+func (m *memKV) Put(key string, value []byte) error {
+	m.data[key] = value
+	return nil
+}
+
+func (m *memKV) Delete(key string) error {
+	delete(m.data, key)
+	return nil
+}
+
+type memBlobs struct {
+	data map[string][]byte
+}
+
+func newMemBlobs() *memBlobs {
+	return &memBlobs{data: make(map[string][]byte)}
+}
+
+func (m *memBlobs) Get(path string) (io.Reader, error) {
+	body, ok := m.data[path]
+	if !ok {
+		return nil, nil
+	}
+	return bytes.NewReader(body), nil
+}
+
+func (m *memBlobs) Put(path string, data io.Reader) error {
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	m.data[path] = body
+	return nil
+}
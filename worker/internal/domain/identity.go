@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query parameters of ad and analytics tools, they never change the page
+var trackingParams = []string{
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"twclid",
+	"ttclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+}
+
+// StripTrackingParams removes utm_* and other known tracking parameters from the query
+func StripTrackingParams(query url.Values) url.Values {
+	for name := range query {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "utm_") || slices.Contains(trackingParams, lower) {
+			query.Del(name)
+		}
+	}
+	return query
+}
+
+// CleanAppURL normalizes the app URL the way every alias of the app is identified:
+// the host is lowercased, the fragment and tracking parameters are dropped
+func CleanAppURL(u *url.URL) *url.URL {
+	clean := *u
+	clean.Host = strings.ToLower(clean.Host)
+	clean.Fragment = ""
+	clean.RawFragment = ""
+
+	if clean.RawQuery != "" {
+		clean.RawQuery = StripTrackingParams(clean.Query()).Encode()
+	}
+
+	return &clean
+}
+
+// Identity returns the URL identifying the app of the scraped page: the final URL after redirects
+// or the canonical URL the page declares. The canonical URL is trusted only on the same site,
+// otherwise any page could take over the cache entries of another site, and it keeps the scheme of the page.
+func (p Page) Identity(requested *url.URL) *url.URL {
+	identity := requested
+	if p.URL != nil {
+		identity = p.URL
+	}
+
+	if p.CanonicalURL != nil && isWebURL(p.CanonicalURL) && sameSite(identity, p.CanonicalURL) {
+		// only the host and the path are taken, an http canonical URL of an HTTPS page would downgrade the app
+		canonical := *p.CanonicalURL
+		canonical.Scheme = identity.Scheme
+		identity = &canonical
+	}
+
+	return CleanAppURL(identity)
+}
+
+func isWebURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// sameSite compares hosts ignoring the www. prefix, e.g. example.com and www.example.com are the same site
+func sameSite(a, b *url.URL) bool {
+	hostA := strings.TrimPrefix(strings.ToLower(a.Hostname()), "www.")
+	hostB := strings.TrimPrefix(strings.ToLower(b.Hostname()), "www.")
+	return hostA == hostB && a.Port() == b.Port()
+}
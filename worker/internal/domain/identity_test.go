@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanAppURL(t *testing.T) {
+	u, _ := url.Parse("https://Example.COM/app?utm_source=news&id=7&gclid=abc#top")
+
+	assert.Equal(t, "https://example.com/app?id=7", CleanAppURL(u).String())
+	assert.Equal(t, "https://Example.COM/app?utm_source=news&id=7&gclid=abc#top", u.String(), "the URL must not be modified")
+}
+
+func TestPageIdentity(t *testing.T) {
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+	requested := parse("https://example.com/?utm_source=x")
+
+	tests := []struct {
+		name     string
+		page     Page
+		expected string
+	}{
+		{
+			name:     "requested URL",
+			page:     Page{},
+			expected: "https://example.com/",
+		},
+		{
+			name:     "final URL after redirects",
+			page:     Page{URL: parse("https://www.example.com/home")},
+			expected: "https://www.example.com/home",
+		},
+		{
+			name: "canonical URL of the same site",
+			page: Page{
+				URL:          parse("https://example.com/?utm_source=x"),
+				CanonicalURL: parse("https://www.example.com/"),
+			},
+			expected: "https://www.example.com/",
+		},
+		{
+			name: "http canonical URL doesn't downgrade the scheme",
+			page: Page{
+				URL:          parse("https://example.com/"),
+				CanonicalURL: parse("http://www.example.com/home"),
+			},
+			expected: "https://www.example.com/home",
+		},
+		{
+			name: "canonical URL of another site is ignored",
+			page: Page{
+				URL:          parse("https://example.com/"),
+				CanonicalURL: parse("https://bank.example.org/"),
+			},
+			expected: "https://example.com/",
+		},
+		{
+			name: "canonical URL of another port is ignored",
+			page: Page{
+				URL:          parse("https://example.com/"),
+				CanonicalURL: parse("https://example.com:8443/"),
+			},
+			expected: "https://example.com/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.page.Identity(requested).String())
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxShortNameLength is the short_name length launchers display without truncation
+const MaxShortNameLength = 12
+
+// titleSeparators split page titles like "Inbox - Gmail" into the page and the site parts
+var titleSeparators = []string{" | ", " - ", " – ", " — ", " · ", " :: ", " » "}
+
+// cssColor loosely matches CSS color values: hex, named and functional notations
+var cssColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]{3,32}|[a-zA-Z]{3,5}\([0-9a-zA-Z.,%/+\- ]{1,64}\))$`)
+
+// unreadCounter matches counters web apps prepend to the title, e.g. "(3) Inbox"
+var unreadCounter = regexp.MustCompile(`^\(\d+\+?\)\s*`)
+
+// PageMetadata is the app related metadata scraped from the page's <head>
+type PageMetadata struct {
+	Title           string
+	SiteName        string // og:site_name
+	ApplicationName string // meta[name=application-name]
+	AppleTitle      string // meta[name=apple-mobile-web-app-title]
+	Description     string
+	ThemeColor      string // meta[name=theme-color] for the light or unspecified color scheme
+	ThemeColorDark  string // meta[name=theme-color][media="(prefers-color-scheme: dark)"]
+}
+
+// Name returns the best app name declared by the page or an empty string
+func (m PageMetadata) Name() string {
+	for _, name := range []string{m.ApplicationName, m.AppleTitle, m.SiteName} {
+		if name = cleanName(name); name != "" {
+			return name
+		}
+	}
+
+	return siteTitle(m.Title)
+}
+
+// ShortName returns the first declared name fitting MaxShortNameLength,
+// otherwise the app name is shortened by words
+func (m PageMetadata) ShortName() string {
+	for _, name := range []string{m.AppleTitle, m.ApplicationName, m.SiteName, siteTitle(m.Title)} {
+		name = cleanName(name)
+		if name != "" && utf8.RuneCountInString(name) <= MaxShortNameLength {
+			return name
+		}
+	}
+
+	return ShortenName(m.Name())
+}
+
+// ShortenName cuts the name down to MaxShortNameLength keeping whole words where possible
+func ShortenName(name string) string {
+	name = cleanName(name)
+	if utf8.RuneCountInString(name) <= MaxShortNameLength {
+		return name
+	}
+
+	var short string
+	for _, word := range strings.Fields(name) {
+		candidate := strings.TrimSpace(short + " " + word)
+		if utf8.RuneCountInString(candidate) > MaxShortNameLength {
+			break
+		}
+		short = candidate
+	}
+
+	if short != "" {
+		return short
+	}
+
+	return string([]rune(name)[:MaxShortNameLength])
+}
+
+// siteTitle extracts the site part of the page title, sites usually put their name last: "Page | Site"
+func siteTitle(title string) string {
+	title = unreadCounter.ReplaceAllString(cleanName(title), "")
+
+	for _, separator := range titleSeparators {
+		if !strings.Contains(title, separator) {
+			continue
+		}
+		parts := strings.Split(title, separator)
+		for i := len(parts) - 1; i >= 0; i-- {
+			if part := strings.TrimSpace(parts[i]); part != "" {
+				return part
+			}
+		}
+	}
+
+	return title
+}
+
+// ValidColor reports whether the value looks like a CSS color, so it's safe to put into a manifest or a page
+func ValidColor(value string) bool {
+	return cssColor.MatchString(value)
+}
+
+func cleanName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageMetadataNames(t *testing.T) {
+	tests := []struct {
+		name              string
+		metadata          PageMetadata
+		expectedName      string
+		expectedShortName string
+	}{
+		{
+			name:              "empty",
+			metadata:          PageMetadata{},
+			expectedName:      "",
+			expectedShortName: "",
+		},
+		{
+			name:              "title with site suffix and counter",
+			metadata:          PageMetadata{Title: "(3) Inbox - someone@example.com - Gmail"},
+			expectedName:      "Gmail",
+			expectedShortName: "Gmail",
+		},
+		{
+			name: "application name wins over the title",
+			metadata: PageMetadata{
+				Title:           "Dashboard | Example",
+				ApplicationName: "Example Analytics Dashboard",
+				AppleTitle:      "Analytics",
+			},
+			expectedName:      "Example Analytics Dashboard",
+			expectedShortName: "Analytics",
+		},
+		{
+			name: "site name",
+			metadata: PageMetadata{
+				Title:    "Some article about things",
+				SiteName: "  The   Daily\nNews ",
+			},
+			expectedName:      "The Daily News",
+			expectedShortName: "The Daily",
+		},
+		{
+			name:              "single long word is cut",
+			metadata:          PageMetadata{Title: "Supercalifragilistic"},
+			expectedName:      "Supercalifragilistic",
+			expectedShortName: "Supercalifra",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedName, tt.metadata.Name())
+			assert.Equal(t, tt.expectedShortName, tt.metadata.ShortName())
+		})
+	}
+}
+
+func TestValidColor(t *testing.T) {
+	for _, c := range []string{"#fff", "#3367D6", "#3367d6cc", "rebeccapurple", "rgb(255, 0, 0)", "hsl(120deg 100% 50% / 50%)"} {
+		assert.True(t, ValidColor(c), c)
+	}
+
+	for _, c := range []string{"", "#12", "#zzzzzz", `red"><script>`, "url(javascript:alert(1))", "rgb(1,2,3);x"} {
+		assert.False(t, ValidColor(c), c)
+	}
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+)
+
+// httpPathSegment marks plain HTTP targets in /a/ and /i/ paths, e.g. /a/http/example.com:8080/app.
+// HTTPS targets are encoded without the scheme, so paths made before stay valid.
+const httpPathSegment = "http/"
+
+// SchemePathPrefix returns the path segment encoding the scheme of the target URL, empty for HTTPS
+func SchemePathPrefix(u *url.URL) string {
+	if strings.EqualFold(u.Scheme, "http") {
+		return httpPathSegment
+	}
+	return ""
+}
+
+// SplitSchemePath cuts the optional scheme segment off the target path, e.g. "http/host:8080/path".
+// Paths without the segment target HTTPS.
+func SplitSchemePath(p string) (scheme, rest string) {
+	segment, rest, found := strings.Cut(p, "/")
+	if found && rest != "" {
+		switch strings.ToLower(segment) {
+		case "http", "https":
+			return strings.ToLower(segment), rest
+		}
+	}
+	return "https", p
+}
+
+// KeyHost is the host cache keys are made of. Default ports are omitted, so keys of apps on them
+// stay the same as before ports were kept. Apps on other ports used to share the key of the host
+// without the port, they are cached under new keys.
+func KeyHost(u *url.URL) string {
+	defaultPort := "443"
+	if strings.EqualFold(u.Scheme, "http") {
+		defaultPort = "80"
+	}
+	if port := u.Port(); port == "" || port == defaultPort {
+		return u.Hostname()
+	}
+	return u.Host
+}
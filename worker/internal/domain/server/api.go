@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiAppsPrefix is followed by the app the same way as /a/, e.g. /api/v1/apps/example.com/app
+const apiAppsPrefix = "/api/v1/apps/"
+
+// apiApp describes everything the manifest of the app is built from
+type apiApp struct {
+	URL             string      `json:"url"`
+	Identity        string      `json:"identity"`
+	Paths           apiAppPaths `json:"paths"`
+	ManifestVersion string      `json:"manifest_version"`
+	Manifest        pwaManifest `json:"manifest"`
+	Metadata        apiMetadata `json:"metadata"`
+	Icons           []apiIcon   `json:"icons"`
+	Error           *apiError   `json:"error,omitempty"`
+}
+
+type apiAppPaths struct {
+	Page          string `json:"page"`
+	Manifest      string `json:"manifest"`
+	ServiceWorker string `json:"service_worker"`
+}
+
+type apiMetadata struct {
+	Title           string `json:"title,omitempty"`
+	SiteName        string `json:"site_name,omitempty"`
+	ApplicationName string `json:"application_name,omitempty"`
+	AppleTitle      string `json:"apple_title,omitempty"`
+	Description     string `json:"description,omitempty"`
+	ThemeColor      string `json:"theme_color,omitempty"`
+	ThemeColorDark  string `json:"theme_color_dark,omitempty"`
+}
+
+// apiIcon is an icon candidate of the page, the declared attributes come from the page or its manifest
+// and the image ones from the downloaded icon
+type apiIcon struct {
+	SourceURL string `json:"source_url"`
+	Rel       string `json:"rel,omitempty"`
+	Sizes     string `json:"sizes,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	Media     string `json:"media,omitempty"`
+	Cached    bool   `json:"cached"`
+	Path      string `json:"path,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+	ImageSize string `json:"image_sizes,omitempty"`
+}
+
+type apiError struct {
+	Reason      string    `json:"reason"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	FailedAt    time.Time `json:"failed_at"`
+}
+
+func (s *server) handleAPIApp(w http.ResponseWriter, req *http.Request) {
+	appU, err := parseAPIAppURL(req.URL)
+	if err != nil {
+		slog.Error("failed to parse app URL", "err", err)
+		writeAPIError(w, http.StatusBadRequest, "invalid app URL")
+		return
+	}
+	if appU.resource != "" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if appU.refresh {
+		err = s.iconsFetcher.ForgetFailure(&appU.URL)
+		if err != nil {
+			slog.Error("failed to forget scrape failure", "err", err)
+		}
+	}
+
+	app := s.iconsFetcher.FetchApp(req.Context(), &appU.URL)
+	manifest, version := manifestFromApp(appU, app)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	err = json.NewEncoder(w).Encode(describeApp(appU, app, manifest, version))
+	if err != nil {
+		slog.Error("failed to write app description", "err", err)
+	}
+}
+
+func describeApp(appU *appURL, app domain.App, manifest pwaManifest, version string) apiApp {
+	described := apiApp{
+		URL:      appU.String(),
+		Identity: appU.String(),
+		Paths: apiAppPaths{
+			Page:          appU.pagePath(),
+			Manifest:      manifestURL(appU.manifestPath(), version),
+			ServiceWorker: appU.serviceWorkerPath(),
+		},
+		ManifestVersion: version,
+		Manifest:        manifest,
+		Metadata:        apiMetadata(app.Metadata),
+		Icons:           describeIcons(app.IconLinks, app.Icons),
+	}
+
+	if app.Identity != nil {
+		described.Identity = app.Identity.String()
+	}
+
+	if app.Failure != nil {
+		described.Error = &apiError{
+			Reason:      app.Failure.Reason,
+			Status:      app.Failure.Status,
+			ContentType: app.Failure.ContentType,
+			Message:     app.Failure.Message,
+			FailedAt:    app.Failure.FailedAt,
+		}
+	}
+
+	return described
+}
+
+// describeIcons lists the icon candidates, the ones the app has icons for are cached
+func describeIcons(links []domain.IconLink, icons []domain.Icon) []apiIcon {
+	cached := make(map[string]domain.Icon, len(icons))
+	for _, icon := range icons {
+		cached[icon.URL.String()] = icon
+	}
+
+	described := make([]apiIcon, 0, len(links))
+	for _, link := range links {
+		// inline icons are cached under their stable URLs, data URIs are too long to report
+		sourceURL := domain.InlineIconURL(link.URL)
+		icon := apiIcon{
+			SourceURL: sourceURL.String(),
+			Rel:       link.Rel,
+			Sizes:     link.Sizes,
+			Type:      link.Type,
+			Purpose:   link.Purpose,
+			Media:     link.Media,
+		}
+
+		if cachedIcon, found := cached[sourceURL.String()]; found {
+			icon.Cached = true
+			icon.Path = cachedIcon.Path()
+			icon.MimeType = cachedIcon.Props.MimeType
+			icon.ImageSize = cachedIcon.Props.SizesAttr()
+		}
+
+		described = append(described, icon)
+	}
+
+	return described
+}
+
+// parseAPIAppURL reads the app the same way as /a/ paths do
+func parseAPIAppURL(u *url.URL) (*appURL, error) {
+	if !strings.HasPrefix(u.Path, apiAppsPrefix) {
+		return nil, fmt.Errorf("invalid API path: %s", u.Path)
+	}
+
+	appPath := *u
+	appPath.Path = "/a/" + strings.TrimPrefix(u.Path, apiAppsPrefix)
+
+	return parseAppURL(&appPath)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(map[string]string{"error": message})
+	if err != nil {
+		slog.Error("failed to write API error", "err", err)
+	}
+}
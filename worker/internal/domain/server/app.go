@@ -3,6 +3,7 @@ package server
 import (
 	"errors"
 	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -13,18 +14,19 @@ const (
 	manifestPath      = "/manifest.json"
 	serviceWorkerPath = "/service-worker.js"
 	redirectPagePath  = "/redirect.html"
-)
+	offlinePagePath   = "/offline.html"
 
-func (s *server) handleApp(w http.ResponseWriter, req *http.Request) {
-	urlPath := req.URL.Path
+	// resourceSegment separates the site path from files of the app, e.g. /a/example.com/app/-/manifest.json.
+	// Site path segments of dashes only get one more dash, so any site path can be an app.
+	resourceSegment = "-"
+	// appPageResource is the app page of a site path ending in a legacy file name, e.g. /a/example.com/manifest.json/-/
+	appPageResource = "/"
 
-	parts := strings.SplitN(urlPath, "/", 3)
-	if len(parts) < 3 {
-		//If the path is not in the expected format, return a default response
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
-		return
-	}
+	// refreshParam=1 retries scraping a page that failed recently, e.g. /a/example.com?refresh=1
+	refreshParam = "refresh"
+)
 
+func (s *server) handleApp(w http.ResponseWriter, req *http.Request) {
 	appU, err := parseAppURL(req.URL)
 	if err != nil {
 		slog.Error("failed to parse app URL", "err", err)
@@ -33,16 +35,31 @@ func (s *server) handleApp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if appU.resource != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", allowedMethods([]string{http.MethodGet}))
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	ctx := req.Context()
 
-	switch {
-	case strings.HasSuffix(urlPath, manifestPath):
+	if appU.refresh {
+		err = s.iconsFetcher.ForgetFailure(&appU.URL)
+		if err != nil {
+			slog.Error("failed to forget scrape failure", "err", err)
+		}
+	}
+
+	switch appU.resource {
+	case manifestPath:
 		s.handleManifest(ctx, w, appU)
-	case strings.HasSuffix(urlPath, serviceWorkerPath):
-		s.handleServiceWorker(w, appU)
-	case strings.HasSuffix(urlPath, redirectPagePath):
+	case serviceWorkerPath:
+		s.handleServiceWorker(ctx, w, appU)
+	case offlinePagePath:
+		s.handleOfflinePage(w, appU)
+	case redirectPagePath:
 		s.handleRedirect(w, appU)
-	default:
+	case "":
 		// Default handler: show info page with links to manifest and service worker
 
 		var iconURLs []*url.URL
@@ -64,10 +81,28 @@ func (s *server) handleApp(w http.ResponseWriter, req *http.Request) {
 				}
 				iconURLs = append(iconURLs, iconURL)
 			}
+
+			// the app URL's query belongs to the site, so overrides are only read from the form body
+			settings, err := domain.ParseAppSettings(req.PostForm)
+			if err != nil {
+				http.Error(w, "Invalid app settings: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !settings.IsZero() {
+				err = s.iconsFetcher.StoreSettings(&appU.URL, settings)
+				if err != nil {
+					slog.Error("failed to store app settings", "err", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+			}
 		}
 		s.handleAppRoot(ctx, w, appU, iconURLs)
+	default:
+		http.NotFound(w, req)
 	}
 }
+
 func parseAppURL(u *url.URL) (*appURL, error) {
 	urlPath := u.Path
 
@@ -76,24 +111,35 @@ func parseAppURL(u *url.URL) (*appURL, error) {
 		return nil, errors.New("Invalid request format")
 	}
 
-	appURLValue := parts[2]
+	appURLValue, resource := splitResource(parts[2])
 
-	fileSuffixes := []string{
-		manifestPath,
-		serviceWorkerPath,
-		redirectPagePath,
+	// apps installed before the resource segment keep their start URLs, manifests and workers
+	legacy := false
+	if resource == "" {
+		for _, file := range legacyFiles {
+			if strings.HasSuffix(appURLValue, file) {
+				appURLValue = strings.TrimSuffix(appURLValue, file)
+				resource, legacy = file, true
+				break
+			}
+		}
 	}
-
-	for _, suffix := range fileSuffixes {
-		appURLValue = strings.TrimSuffix(appURLValue, suffix)
+	if resource == appPageResource {
+		resource = ""
 	}
 
-	base := "https://" + appURLValue
+	scheme, appURLValue := domain.SplitSchemePath(appURLValue)
+	base := scheme + "://" + appURLValue
 
-	query := u.Query()
-	if strings.HasSuffix(urlPath, manifestPath) {
+	// tracking parameters would end up in the start URL of the installed app
+	query := domain.StripTrackingParams(u.Query())
+	if resource == manifestPath {
 		query.Del("v")
 	}
+	refresh := query.Get(refreshParam) == "1"
+	if refresh {
+		query.Del(refreshParam)
+	}
 
 	if encoded := query.Encode(); encoded != "" {
 		base += "?" + encoded
@@ -104,5 +150,60 @@ func parseAppURL(u *url.URL) (*appURL, error) {
 		return nil, fmt.Errorf("failed to parse app URL: %w", err)
 	}
 
-	return &appURL{URL: *parsedURL}, nil
+	if parsedURL.Host == "" {
+		return nil, errors.New("app host is missing")
+	}
+
+	return &appURL{URL: *parsedURL, refresh: refresh, resource: resource, legacy: legacy}, nil
+}
+
+// legacyFiles were served right after the site path, e.g. /a/example.com/app/manifest.json
+var legacyFiles = []string{manifestPath, serviceWorkerPath, redirectPagePath, offlinePagePath}
+
+// isLegacyFile tells whether the site path would be read as a legacy file of the app
+func isLegacyFile(sitePath string) bool {
+	for _, file := range legacyFiles {
+		if strings.HasSuffix(sitePath, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyPath is the path of the app's file before the resource segment
+func legacyPath(p string) string {
+	i := strings.LastIndex(p, "/"+resourceSegment+"/")
+	if i < 0 {
+		return p
+	}
+	return p[:i] + p[i+len(resourceSegment)+1:]
+}
+
+// splitResource cuts the app's file off the target path and unescapes the site path, see resourceSegment
+func splitResource(target string) (sitePath, resource string) {
+	segments := strings.Split(target, "/")
+	for i, segment := range segments {
+		if segment == resourceSegment {
+			return strings.Join(segments[:i], "/"), "/" + strings.Join(segments[i+1:], "/")
+		}
+		if isDashes(segment) {
+			segments[i] = segment[1:]
+		}
+	}
+	return strings.Join(segments, "/"), ""
+}
+
+// escapeSitePath adds a dash to segments of dashes only, so they aren't taken for the resourceSegment
+func escapeSitePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		if isDashes(segment) {
+			segments[i] = "-" + segment
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isDashes(segment string) bool {
+	return segment != "" && strings.Trim(segment, "-") == ""
 }
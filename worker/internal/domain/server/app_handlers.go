@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nazar256/intopwa/internal/domain"
+	"github.com/nazar256/intopwa/internal/pkg/imaging"
+	htmltemplate "html/template"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -18,19 +20,64 @@ import (
 type pwaManifest struct {
 	Name            string    `json:"name,omitempty"`
 	ShortName       string    `json:"short_name,omitempty"`
+	Description     string    `json:"description,omitempty"`
 	Icons           []pwaIcon `json:"icons,omitempty"`
 	StartURL        string    `json:"start_url"`
 	BackgroundColor string    `json:"background_color,omitempty"`
 	ThemeColor      string    `json:"theme_color,omitempty"`
 	Display         string    `json:"display"`
+	Orientation     string    `json:"orientation,omitempty"`
+
+	// themeColorDark isn't part of the manifest, it's only used by pages for the dark color scheme
+	themeColorDark string
+	// strategy isn't part of the manifest either, it's the cache strategy of the service worker
+	strategy string
 }
 
 type pwaIcon struct {
-	Src   string `json:"src"`
-	Type  string `json:"type"`
-	Sizes string `json:"sizes"`
+	Src     string `json:"src"`
+	Type    string `json:"type"`
+	Sizes   string `json:"sizes"`
+	Purpose string `json:"purpose,omitempty"`
+	// hash of the icon content, it changes when the site replaces the image under the same URL
+	hash string
+}
+
+const (
+	defaultColor    = "#3367D6"
+	lightBackground = "#FFFFFF"
+	defaultDisplay  = "standalone"
+)
+
+// appPageData fills the install page, see templates/app.html
+type appPageData struct {
+	Title             string
+	Manifest          pwaManifest
+	ThemeColor        string
+	ThemeColorDark    string
+	ManifestHref      string
+	IconHref          string
+	ServiceWorkerPath string
+	// ServiceWorkerScope is wider than the worker's directory, the header Service-Worker-Allowed permits it
+	ServiceWorkerScope string
+	SiteURL            string
+	Checks             []installCheck
+	// Installable is the verdict of the checks decided by the server, pending ones are up to the page script
+	Installable bool
+	// ThemeSwatch and BackgroundSwatch are the manifest colors for style attributes, the CSS escaper
+	// would replace functional notations like rgb() with ZgotmplZ
+	ThemeSwatch      htmltemplate.CSS
+	BackgroundSwatch htmltemplate.CSS
 }
 
+// redirectPageData fills the page the installed app starts on, see templates/redirect.html
+type redirectPageData struct {
+	URL string
+}
+
+// supportedDisplays are display modes of installable apps, "browser" is ignored since it opens a regular tab
+var supportedDisplays = []string{"standalone", "fullscreen", "minimal-ui"}
+
 func (s *server) handleAppRoot(ctx context.Context, w http.ResponseWriter, u *appURL, iconURLs []*url.URL) {
 	err := s.iconsFetcher.CacheIcons(ctx, &u.URL, iconURLs)
 	if err != nil {
@@ -38,56 +85,46 @@ func (s *server) handleAppRoot(ctx context.Context, w http.ResponseWriter, u *ap
 	}
 
 	manifest, version := s.buildManifest(ctx, u)
-	manifestHref := manifestURL(u.manifestPath(), version)
-
-	w.Header().Set("Content-Type", "text/html")
-
-	infoPage := fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-<meta charset="UTF-8">
-
-<meta name="theme-color" content="#317EFB"/>
-<meta name="viewport" content="width=device-width, initial-scale=1.0">
-<title>%s</title>
-<link rel="manifest" href="%s">
-<link rel="apple-touch-icon" href="%s">
-<link rel="icon" type="image/x-icon" href="/favicon.ico">
-<link rel="icon" type="image/png" sizes="32x32" href="/favicon-32x32.png">
-<link rel="icon" type="image/png" sizes="16x16" href="/favicon-16x16.png">
-<link rel="stylesheet" href="/styles.css">
-<script>
-if ('serviceWorker' in navigator) {
-navigator.serviceWorker.register('%s')
-.then(function(registration) {
-console.log('Service Worker registered with scope:', registration.scope);
-}).catch(function(error) {
-console.log('Service Worker registration failed:', error);
-});
-}
-</script>
-</head>
-<body>
-<div class="container">
-<h2>Install this app</h2>
-<h3>Mobile:</h3>
-<p>Tap the browser menu (⋮) and select 'Add to Home Screen' or 'Install App'</p>
-<h3>Desktop:</h3>
-<p>Click the install icon (⇩) in your browser's address bar</p>
-</div>
-</body>
-</html>
-`, "App for "+u.URL.Hostname(), manifestHref, manifest.Icons[0].Src, u.serviceWorkerPath())
-
-	_, err = fmt.Fprintln(w, infoPage)
-	if err != nil {
-		slog.Error("failed to write app root", "err", err)
+
+	checks := installChecks(manifest, u.scopePath())
+
+	renderTemplate(w, appPageTemplate, "text/html", appPageData{
+		Title:              "App for " + u.URL.Hostname(),
+		Manifest:           manifest,
+		ThemeColor:         manifest.ThemeColor,
+		ThemeColorDark:     manifest.themeColorDark,
+		ManifestHref:       manifestURL(u.manifestPath(), version),
+		IconHref:           appleTouchIconSrc(manifest.Icons),
+		ServiceWorkerPath:  u.serviceWorkerPath(),
+		ServiceWorkerScope: u.scopePath(),
+		SiteURL:            u.String(),
+		Checks:             checks,
+		Installable:        installable(checks),
+		ThemeSwatch:        swatch(manifest.ThemeColor),
+		BackgroundSwatch:   swatch(manifest.BackgroundColor),
+	})
+}
+
+// colorFunctions are the functional notations swatches accept, other functions like url() aren't colors
+var colorFunctions = []string{"rgb", "rgba", "hsl", "hsla", "hwb", "lab", "lch", "oklab", "oklch", "color"}
+
+// swatch trusts colors validated by domain.ValidColor as CSS, anything else renders no color
+func swatch(color string) htmltemplate.CSS {
+	if !domain.ValidColor(color) {
+		return ""
+	}
+	if name, _, functional := strings.Cut(color, "("); functional && !slices.Contains(colorFunctions, strings.ToLower(name)) {
+		return ""
 	}
+	return htmltemplate.CSS(color)
 }
 
 func (s *server) handleManifest(ctx context.Context, w http.ResponseWriter, appURL *appURL) {
 	manifest, version := s.buildManifest(ctx, appURL)
+	if appURL.legacy {
+		// the start URL is the id of installed apps, a new one would make them another app
+		manifest.StartURL = legacyPath(manifest.StartURL)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -101,37 +138,8 @@ func (s *server) handleManifest(ctx context.Context, w http.ResponseWriter, appU
 	}
 }
 
-func (s *server) handleServiceWorker(w http.ResponseWriter, u *appURL) {
-	swScript := `self.addEventListener('install', event => {
-		event.waitUntil(
-			caches.open('v1').then(cache => {
-				return cache.addAll(['` + u.redirectPagePath() + `']);
-			})
-		);
-	});
-	self.addEventListener('fetch', event => {
-		event.respondWith(
-			caches.match(event.request).then(response => {
-				return response || fetch(event.request);
-			})
-		);
-	});`
-
-	w.Header().Set("Content-Type", "application/javascript")
-	_, err := fmt.Fprintln(w, swScript)
-	if err != nil {
-		slog.Error("failed to write service worker script", "err", err)
-	}
-}
-
 func (s *server) handleRedirect(w http.ResponseWriter, u *appURL) {
-	redirectHTML := fmt.Sprintf(`<html><head><meta http-equiv="refresh" content="0;url=%s"></head></html>`, u.String())
-
-	w.Header().Set("Content-Type", "text/html")
-	_, err := fmt.Fprintln(w, redirectHTML)
-	if err != nil {
-		slog.Error("failed to write redirect page", "err", err)
-	}
+	renderTemplate(w, redirectPageTemplate, "text/html", redirectPageData{URL: u.String()})
 }
 
 func ensureAnyIcon(icons []pwaIcon) []pwaIcon {
@@ -147,9 +155,14 @@ func ensureAnyIcon(icons []pwaIcon) []pwaIcon {
 }
 
 func (s *server) buildManifest(ctx context.Context, appURL *appURL) (pwaManifest, string) {
+	return manifestFromApp(appURL, s.iconsFetcher.FetchApp(ctx, &appURL.URL))
+}
+
+// manifestFromApp builds the manifest of the fetched app and its version
+func manifestFromApp(appURL *appURL, app domain.App) (pwaManifest, string) {
 	title := fmt.Sprintf(appURL.URL.Hostname() + appURL.URL.Path)
 
-	icons := s.iconsFetcher.FetchIcons(ctx, &appURL.URL)
+	icons := app.Icons
 
 	slices.SortFunc(icons, func(a, b domain.Icon) int {
 		sizeA := a.Props.Size.Width * a.Props.Size.Height
@@ -163,9 +176,11 @@ func (s *server) buildManifest(ctx context.Context, appURL *appURL) (pwaManifest
 	var pwaIcons []pwaIcon
 	for _, icon := range icons {
 		pwaIcons = append(pwaIcons, pwaIcon{
-			Src:   icon.Path(),
-			Type:  icon.Props.MimeType,
-			Sizes: icon.Props.Size.String(),
+			Src:     icon.Path(),
+			Type:    icon.Props.MimeType,
+			Sizes:   icon.Props.SizesAttr(),
+			Purpose: cmp.Or(icon.Purpose, domain.PurposeAny),
+			hash:    icon.Hash,
 		})
 	}
 
@@ -173,20 +188,134 @@ func (s *server) buildManifest(ctx context.Context, appURL *appURL) (pwaManifest
 		slog.Info("no icons found for app, using default icon", "host", appURL.URL.Hostname())
 	}
 
-	pwaIcons = ensureAnyIcon(pwaIcons)
-	version := manifestVersion(pwaIcons)
-
 	manifest := pwaManifest{
 		Name:            title,
-		ShortName:       title,
-		Icons:           pwaIcons,
+		ShortName:       domain.ShortenName(strings.TrimPrefix(appURL.URL.Hostname(), "www.")),
+		Icons:           ensureAnyIcon(pwaIcons),
 		StartURL:        appURL.redirectPagePath(),
-		BackgroundColor: "#3367D6",
-		ThemeColor:      "#3367D6",
-		Display:         "standalone",
+		BackgroundColor: defaultColor,
+		ThemeColor:      defaultColor,
+		Display:         defaultDisplay,
+		strategy:        app.Settings.Strategy(),
 	}
 
-	return manifest, version
+	applyPageMetadata(&manifest, app.Metadata)
+	applyThemeColors(&manifest, app.Metadata, icons)
+	applySiteManifest(&manifest, app.Manifest)
+	applySettings(&manifest, appURL, app.Settings)
+	addMaskableIcons(&manifest, icons)
+
+	return manifest, manifestVersion(manifest.Icons, app.Settings)
+}
+
+// applyPageMetadata names the app after the page instead of its URL when the page declares a name
+func applyPageMetadata(manifest *pwaManifest, metadata domain.PageMetadata) {
+	if name := metadata.Name(); name != "" {
+		manifest.Name = name
+		manifest.ShortName = metadata.ShortName()
+	}
+	manifest.Description = metadata.Description
+}
+
+// applyThemeColors colors the title bar and the splash screen after the site.
+// The page's theme-color is preferred, otherwise the dominant color of the biggest icon is used.
+func applyThemeColors(manifest *pwaManifest, metadata domain.PageMetadata, icons []domain.Icon) {
+	manifest.themeColorDark = metadata.ThemeColorDark
+
+	if metadata.ThemeColor != "" {
+		manifest.ThemeColor = metadata.ThemeColor
+		manifest.BackgroundColor = metadata.ThemeColor
+		return
+	}
+
+	for _, icon := range icons {
+		if icon.Props.DominantColor == "" {
+			continue
+		}
+		manifest.ThemeColor = icon.Props.DominantColor
+		// the splash screen shows the icon, so it must not blend into the background
+		manifest.BackgroundColor = lightBackground
+		return
+	}
+}
+
+// applySiteManifest prefers values from the site's own manifest over the generated ones
+func applySiteManifest(manifest *pwaManifest, site *domain.WebManifest) {
+	if site == nil {
+		return
+	}
+
+	if site.Name != "" {
+		manifest.Name = site.Name
+		manifest.ShortName = domain.ShortenName(site.Name)
+	}
+	if site.ShortName != "" {
+		manifest.ShortName = site.ShortName
+	}
+	if domain.ValidColor(site.ThemeColor) {
+		manifest.ThemeColor = site.ThemeColor
+	}
+	if domain.ValidColor(site.BackgroundColor) {
+		manifest.BackgroundColor = site.BackgroundColor
+	}
+	if slices.Contains(supportedDisplays, site.Display) {
+		manifest.Display = site.Display
+	}
+}
+
+// applySettings applies the user's overrides, they win over everything scraped from the site
+func applySettings(manifest *pwaManifest, u *appURL, settings domain.AppSettings) {
+	if settings.Name != "" {
+		manifest.Name = settings.Name
+		manifest.ShortName = domain.ShortenName(settings.Name)
+	}
+	if settings.ShortName != "" {
+		manifest.ShortName = settings.ShortName
+	}
+	if settings.Display != "" {
+		manifest.Display = settings.Display
+	}
+	if settings.Orientation != "" {
+		manifest.Orientation = settings.Orientation
+	}
+	if settings.ThemeColor != "" {
+		manifest.ThemeColor = settings.ThemeColor
+	}
+	if settings.BackgroundColor != "" {
+		manifest.BackgroundColor = settings.BackgroundColor
+	}
+	if startURL, err := settings.StartURL(); settings.StartPath != "" && err == nil {
+		start := &appURL{URL: u.URL}
+		start.Path = startURL.Path
+		start.RawQuery = startURL.RawQuery
+		manifest.StartURL = start.redirectPagePath()
+	}
+}
+
+// addMaskableIcons adds maskable variants padded on the theme color, so launchers cropping icons
+// into circles don't cut logos off. Sizes the site provides maskable icons for are kept as is.
+func addMaskableIcons(manifest *pwaManifest, icons []domain.Icon) {
+	source, found := domain.ResizingSource(icons)
+	if !found {
+		return
+	}
+
+	for _, size := range domain.VariantSizes {
+		iconSize := domain.ImageSize{Width: size, Height: size}
+		if slices.ContainsFunc(icons, func(icon domain.Icon) bool {
+			return icon.Props.HasSize(iconSize) && domain.HasPurpose(icon.Purpose, domain.PurposeMaskable)
+		}) {
+			continue
+		}
+
+		variant := domain.Icon{URL: domain.MaskableVariantURL(source.URL, size, manifest.ThemeColor)}
+		manifest.Icons = append(manifest.Icons, pwaIcon{
+			Src:     variant.Path(),
+			Type:    imaging.PNGMimeType,
+			Sizes:   iconSize.String(),
+			Purpose: domain.PurposeMaskable,
+		})
+	}
 }
 
 func manifestURL(manifestPath string, version string) string {
@@ -202,7 +331,7 @@ func manifestURL(manifestPath string, version string) string {
 	return manifestPath + separator + "v=" + url.QueryEscape(version)
 }
 
-func manifestVersion(icons []pwaIcon) string {
+func manifestVersion(icons []pwaIcon, settings domain.AppSettings) string {
 	sorted := make([]pwaIcon, len(icons))
 	copy(sorted, icons)
 
@@ -213,7 +342,10 @@ func manifestVersion(icons []pwaIcon) string {
 		if c := cmp.Compare(a.Type, b.Type); c != 0 {
 			return c
 		}
-		return cmp.Compare(a.Sizes, b.Sizes)
+		if c := cmp.Compare(a.Sizes, b.Sizes); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Purpose, b.Purpose)
 	})
 
 	hasher := sha256.New()
@@ -221,6 +353,12 @@ func manifestVersion(icons []pwaIcon) string {
 		hasher.Write([]byte(icon.Src))
 		hasher.Write([]byte(icon.Type))
 		hasher.Write([]byte(icon.Sizes))
+		hasher.Write([]byte(icon.Purpose))
+		hasher.Write([]byte(icon.hash))
+	}
+	if !settings.IsZero() {
+		// the version changes with the overrides, so browsers pick up the updated manifest
+		_, _ = fmt.Fprintf(hasher, "%+v", settings)
 	}
 
 	return hex.EncodeToString(hasher.Sum(nil))
@@ -22,8 +22,26 @@ func TestParseAppURL(t *testing.T) {
 		},
 		{
 			name:     "Manifest URL",
+			input:    "https://example.com/a/google.com/some/path/-" + manifestPath,
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path"}, resource: manifestPath},
+			err:      nil,
+		},
+		{
+			name:     "Legacy manifest URL",
 			input:    "https://example.com/a/google.com/some/path" + manifestPath,
-			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path"}},
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path"}, resource: manifestPath, legacy: true},
+			err:      nil,
+		},
+		{
+			name:     "Site path ending in a file name of the app",
+			input:    "https://example.com/a/google.com/some/manifest.json/-/",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/manifest.json"}},
+			err:      nil,
+		},
+		{
+			name:     "Site path segments of dashes are escaped",
+			input:    "https://example.com/a/google.com/--/some/---/path/-/redirect.html",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/-/some/--/path"}, resource: redirectPagePath},
 			err:      nil,
 		},
 		{
@@ -40,8 +58,38 @@ func TestParseAppURL(t *testing.T) {
 		},
 		{
 			name:     "Version param is ignored",
-			input:    "https://example.com/a/google.com/manifest.json?v=123",
-			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: ""}},
+			input:    "https://example.com/a/google.com/-/manifest.json?v=123",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: ""}, resource: manifestPath},
+			err:      nil,
+		},
+		{
+			name:     "Plain HTTP with port",
+			input:    "https://example.com/a/http/intranet.local:8080/app/-" + manifestPath,
+			expected: &appURL{URL: url.URL{Scheme: "http", Host: "intranet.local:8080", Path: "/app"}, resource: manifestPath},
+			err:      nil,
+		},
+		{
+			name:     "Explicit HTTPS",
+			input:    "https://example.com/a/https/google.com/some/path",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path"}},
+			err:      nil,
+		},
+		{
+			name:     "Tracking params are stripped",
+			input:    "https://example.com/a/google.com/some/path?utm_source=x&UTM_Medium=y&fbclid=1&foo=bar",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path", RawQuery: "foo=bar"}},
+			err:      nil,
+		},
+		{
+			name:     "Refresh param is a control",
+			input:    "https://example.com/a/google.com/some/path?refresh=1&foo=bar",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path", RawQuery: "foo=bar"}, refresh: true},
+			err:      nil,
+		},
+		{
+			name:     "Refresh param of the site is kept",
+			input:    "https://example.com/a/google.com/some/path?refresh=daily",
+			expected: &appURL{URL: url.URL{Scheme: "https", Host: "google.com", Path: "/some/path", RawQuery: "refresh=daily"}},
 			err:      nil,
 		},
 		{
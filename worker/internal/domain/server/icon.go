@@ -3,6 +3,7 @@ package server
 import (
 	"errors"
 	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -49,8 +50,9 @@ func parseIconURL(u *url.URL) (*url.URL, error) {
 		iconURLstr += "?" + u.RawQuery
 	}
 
-	// Add https:// scheme and parse the URL
-	fullURL, err := url.Parse("https://" + iconURLstr)
+	// the scheme is https unless the path starts with it, e.g. /i/http/host:8080/icon.png
+	scheme, iconURLstr := domain.SplitSchemePath(iconURLstr)
+	fullURL, err := url.Parse(scheme + "://" + iconURLstr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse icon URL: %w", err)
 	}
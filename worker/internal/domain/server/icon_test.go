@@ -20,6 +20,12 @@ func TestParseIconURL(t *testing.T) {
 			expected: &url.URL{Scheme: "https", Host: "google.com", Path: "/static/icon.png"},
 			err:      nil,
 		},
+		{
+			name:     "Plain HTTP with port",
+			input:    "https://example.com/i/http/intranet.local:8080/static/icon.png?s=192",
+			expected: &url.URL{Scheme: "http", Host: "intranet.local:8080", Path: "/static/icon.png", RawQuery: "s=192"},
+			err:      nil,
+		},
 		{
 			name:     "Invalid URL",
 			input:    "https://example.com/google.com",
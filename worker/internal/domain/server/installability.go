@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// installCheck is one of Chrome's installability criteria checked for the install page
+type installCheck struct {
+	Name   string
+	Detail string
+	Passed bool
+	// Pending checks can't be told by the server, the page script decides them, e.g. the service worker registration
+	Pending bool
+	// ID lets the page script update the check
+	ID string
+}
+
+// installChecks checks the manifest against Chrome's installability criteria,
+// see https://web.dev/articles/install-criteria
+func installChecks(manifest pwaManifest, scope string) []installCheck {
+	checks := []installCheck{
+		{
+			Name:   "Name",
+			Detail: "name or short_name is set",
+			Passed: manifest.Name != "" || manifest.ShortName != "",
+		},
+		iconSizeCheck(manifest.Icons, 192),
+		iconSizeCheck(manifest.Icons, 512),
+		{
+			Name:   "Display",
+			Detail: fmt.Sprintf("display is %s, one of %s", manifest.Display, strings.Join(supportedDisplays, ", ")),
+			Passed: slices.Contains(supportedDisplays, manifest.Display),
+		},
+		startURLCheck(manifest.StartURL, scope),
+		{
+			ID:      "service-worker",
+			Name:    "Service worker",
+			Detail:  "a service worker with a fetch handler is registered by this page",
+			Pending: true,
+		},
+	}
+
+	return checks
+}
+
+// installable tells whether none of the checks decided by the server failed
+func installable(checks []installCheck) bool {
+	return !slices.ContainsFunc(checks, func(check installCheck) bool {
+		return !check.Passed && !check.Pending
+	})
+}
+
+func iconSizeCheck(icons []pwaIcon, size int) installCheck {
+	sizeAttr := domain.ImageSize{Width: size, Height: size}.String()
+
+	return installCheck{
+		Name:   fmt.Sprintf("%dpx icon", size),
+		Detail: fmt.Sprintf("an icon of %s with the any purpose", sizeAttr),
+		Passed: slices.ContainsFunc(icons, func(icon pwaIcon) bool {
+			if !domain.HasPurpose(icon.Purpose, domain.PurposeAny) {
+				return false
+			}
+			sizes := strings.Fields(icon.Sizes)
+			return slices.Contains(sizes, sizeAttr) || slices.Contains(sizes, "any")
+		}),
+	}
+}
+
+// startURLCheck requires the start URL on the origin of the manifest and inside the service worker scope,
+// otherwise the app doesn't open offline
+func startURLCheck(startURL, scope string) installCheck {
+	check := installCheck{Name: "Start URL", Detail: "start_url " + startURL}
+
+	u, err := url.Parse(startURL)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		check.Detail += " is not a path on this site"
+		return check
+	}
+
+	if !strings.HasPrefix(u.Path, scope) {
+		check.Detail += " is outside the service worker scope " + scope
+		return check
+	}
+
+	check.Detail += " is in the service worker scope"
+	check.Passed = true
+	return check
+}
+
+// appleTouchIconSrc picks the icon iOS shows on the home screen: the biggest raster icon with the any purpose,
+// iOS ignores SVG touch icons and crops nothing
+func appleTouchIconSrc(icons []pwaIcon) string {
+	for _, icon := range icons {
+		if domain.HasPurpose(icon.Purpose, domain.PurposeAny) && icon.Type != "image/svg+xml" {
+			return icon.Src
+		}
+	}
+	return icons[0].Src
+}
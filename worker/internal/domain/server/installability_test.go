@@ -0,0 +1,74 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInstallChecks(t *testing.T) {
+	manifest := pwaManifest{
+		Name:     "Mail",
+		Display:  "browser",
+		StartURL: "/a/mail.example.com/-/redirect.html",
+		Icons: []pwaIcon{
+			{Src: "/i/mail.example.com/icon.svg", Type: "image/svg+xml", Sizes: "any", Purpose: "any"},
+			{Src: "/i/mail.example.com/mask.png", Type: "image/png", Sizes: "512x512", Purpose: "maskable"},
+		},
+	}
+
+	passed := make(map[string]bool)
+	for _, check := range installChecks(manifest, "/a/mail.example.com/inbox/") {
+		passed[check.Name] = check.Passed
+	}
+
+	assert.Equal(t, map[string]bool{
+		"Name": true,
+		// scalable icons fit every size
+		"192px icon":     true,
+		"512px icon":     true,
+		"Display":        false,
+		"Start URL":      false,
+		"Service worker": false,
+	}, passed)
+}
+
+func TestStartURLCheck(t *testing.T) {
+	tests := []struct {
+		startURL string
+		passed   bool
+	}{
+		{startURL: "/a/mail.example.com/inbox/-/redirect.html?tab=1", passed: true},
+		{startURL: "/a/mail.example.com/-/redirect.html", passed: false},
+		{startURL: "https://mail.example.com/inbox", passed: false},
+		{startURL: "inbox/redirect.html", passed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.startURL, func(t *testing.T) {
+			check := startURLCheck(tt.startURL, "/a/mail.example.com/inbox/")
+			assert.Equal(t, tt.passed, check.Passed, check.Detail)
+		})
+	}
+}
+
+func TestAppleTouchIconSrc(t *testing.T) {
+	icons := []pwaIcon{
+		{Src: "/i/example.com/icon.svg", Type: "image/svg+xml", Sizes: "any", Purpose: "any"},
+		{Src: "/i/example.com/mask.png", Type: "image/png", Sizes: "512x512", Purpose: "maskable"},
+		{Src: "/i/example.com/icon.png", Type: "image/png", Sizes: "192x192", Purpose: "any"},
+	}
+
+	assert.Equal(t, "/i/example.com/icon.png", appleTouchIconSrc(icons))
+	assert.Equal(t, "/i/example.com/icon.svg", appleTouchIconSrc(icons[:1]))
+}
+
+func TestInstallableLeavesPendingChecksToThePage(t *testing.T) {
+	checks := []installCheck{
+		{Name: "Name", Passed: true},
+		{Name: "Service worker", Pending: true},
+	}
+	assert.True(t, installable(checks))
+
+	checks = append(checks, installCheck{Name: "Display"})
+	assert.False(t, installable(checks))
+}
@@ -72,51 +72,95 @@ func (_c *IconsFetcher_CacheIcons_Call) RunAndReturn(run func(context.Context, *
 	return _c
 }
 
-// FetchIcons provides a mock function with given fields: ctx, u
-func (_m *IconsFetcher) FetchIcons(ctx context.Context, u *url.URL) []domain.Icon {
+// FetchApp provides a mock function with given fields: ctx, u
+func (_m *IconsFetcher) FetchApp(ctx context.Context, u *url.URL) domain.App {
 	ret := _m.Called(ctx, u)
 
 	if len(ret) == 0 {
-		panic("no return value specified for FetchIcons")
+		panic("no return value specified for FetchApp")
 	}
 
-	var r0 []domain.Icon
-	if rf, ok := ret.Get(0).(func(context.Context, *url.URL) []domain.Icon); ok {
+	var r0 domain.App
+	if rf, ok := ret.Get(0).(func(context.Context, *url.URL) domain.App); ok {
 		r0 = rf(ctx, u)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]domain.Icon)
-		}
+		r0 = ret.Get(0).(domain.App)
 	}
 
 	return r0
 }
 
-// IconsFetcher_FetchIcons_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FetchIcons'
-type IconsFetcher_FetchIcons_Call struct {
+// IconsFetcher_FetchApp_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FetchApp'
+type IconsFetcher_FetchApp_Call struct {
 	*mock.Call
 }
 
-// FetchIcons is a helper method to define mock.On call
+// FetchApp is a helper method to define mock.On call
 //   - ctx context.Context
 //   - u *url.URL
-func (_e *IconsFetcher_Expecter) FetchIcons(ctx interface{}, u interface{}) *IconsFetcher_FetchIcons_Call {
-	return &IconsFetcher_FetchIcons_Call{Call: _e.mock.On("FetchIcons", ctx, u)}
+func (_e *IconsFetcher_Expecter) FetchApp(ctx interface{}, u interface{}) *IconsFetcher_FetchApp_Call {
+	return &IconsFetcher_FetchApp_Call{Call: _e.mock.On("FetchApp", ctx, u)}
 }
 
-func (_c *IconsFetcher_FetchIcons_Call) Run(run func(ctx context.Context, u *url.URL)) *IconsFetcher_FetchIcons_Call {
+func (_c *IconsFetcher_FetchApp_Call) Run(run func(ctx context.Context, u *url.URL)) *IconsFetcher_FetchApp_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		run(args[0].(context.Context), args[1].(*url.URL))
 	})
 	return _c
 }
 
-func (_c *IconsFetcher_FetchIcons_Call) Return(_a0 []domain.Icon) *IconsFetcher_FetchIcons_Call {
+func (_c *IconsFetcher_FetchApp_Call) Return(_a0 domain.App) *IconsFetcher_FetchApp_Call {
 	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *IconsFetcher_FetchIcons_Call) RunAndReturn(run func(context.Context, *url.URL) []domain.Icon) *IconsFetcher_FetchIcons_Call {
+func (_c *IconsFetcher_FetchApp_Call) RunAndReturn(run func(context.Context, *url.URL) domain.App) *IconsFetcher_FetchApp_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ForgetFailure provides a mock function with given fields: u
+func (_m *IconsFetcher) ForgetFailure(u *url.URL) error {
+	ret := _m.Called(u)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ForgetFailure")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*url.URL) error); ok {
+		r0 = rf(u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IconsFetcher_ForgetFailure_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ForgetFailure'
+type IconsFetcher_ForgetFailure_Call struct {
+	*mock.Call
+}
+
+// ForgetFailure is a helper method to define mock.On call
+//   - u *url.URL
+func (_e *IconsFetcher_Expecter) ForgetFailure(u interface{}) *IconsFetcher_ForgetFailure_Call {
+	return &IconsFetcher_ForgetFailure_Call{Call: _e.mock.On("ForgetFailure", u)}
+}
+
+func (_c *IconsFetcher_ForgetFailure_Call) Run(run func(u *url.URL)) *IconsFetcher_ForgetFailure_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(*url.URL))
+	})
+	return _c
+}
+
+func (_c *IconsFetcher_ForgetFailure_Call) Return(_a0 error) *IconsFetcher_ForgetFailure_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *IconsFetcher_ForgetFailure_Call) RunAndReturn(run func(*url.URL) error) *IconsFetcher_ForgetFailure_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -178,6 +222,53 @@ func (_c *IconsFetcher_One_Call) RunAndReturn(run func(context.Context, *url.URL
 	return _c
 }
 
+// StoreSettings provides a mock function with given fields: u, settings
+func (_m *IconsFetcher) StoreSettings(u *url.URL, settings domain.AppSettings) error {
+	ret := _m.Called(u, settings)
+
+	if len(ret) == 0 {
+		panic("no return value specified for StoreSettings")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*url.URL, domain.AppSettings) error); ok {
+		r0 = rf(u, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IconsFetcher_StoreSettings_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'StoreSettings'
+type IconsFetcher_StoreSettings_Call struct {
+	*mock.Call
+}
+
+// StoreSettings is a helper method to define mock.On call
+//   - u *url.URL
+//   - settings domain.AppSettings
+func (_e *IconsFetcher_Expecter) StoreSettings(u interface{}, settings interface{}) *IconsFetcher_StoreSettings_Call {
+	return &IconsFetcher_StoreSettings_Call{Call: _e.mock.On("StoreSettings", u, settings)}
+}
+
+func (_c *IconsFetcher_StoreSettings_Call) Run(run func(u *url.URL, settings domain.AppSettings)) *IconsFetcher_StoreSettings_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(*url.URL), args[1].(domain.AppSettings))
+	})
+	return _c
+}
+
+func (_c *IconsFetcher_StoreSettings_Call) Return(_a0 error) *IconsFetcher_StoreSettings_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *IconsFetcher_StoreSettings_Call) RunAndReturn(run func(*url.URL, domain.AppSettings) error) *IconsFetcher_StoreSettings_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewIconsFetcher creates a new instance of IconsFetcher. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewIconsFetcher(t interface {
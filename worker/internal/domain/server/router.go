@@ -5,41 +5,156 @@ import (
 	"github.com/nazar256/intopwa/internal/domain"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.43.2 --name iconsFetcher --dir=. --output ./mocks --outpkg mocks --case underscore  --with-expecter --exported
 type iconsFetcher interface {
 	CacheIcons(ctx context.Context, pageURL *url.URL, iconURLs []*url.URL) error
-	FetchIcons(ctx context.Context, u *url.URL) []domain.Icon
+	FetchApp(ctx context.Context, u *url.URL) domain.App
 	One(ctx context.Context, iconURL *url.URL) (domain.Icon, error)
+	StoreSettings(u *url.URL, settings domain.AppSettings) error
+	ForgetFailure(u *url.URL) error
 }
 
 type server struct {
 	iconsFetcher iconsFetcher
+	// allowedOrigins may read responses cross-origin, "*" allows any origin
+	allowedOrigins []string
 }
 
-func New(iconsFetcher iconsFetcher) *server {
-	return &server{
+type Option func(s *server)
+
+// WithAllowedOrigins lets pages of the origins call the worker, e.g. the frontend reading the API
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *server) {
+		s.allowedOrigins = origins
+	}
+}
+
+func New(iconsFetcher iconsFetcher, opts ...Option) *server {
+	s := &server{
 		iconsFetcher: iconsFetcher,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ParseOrigins reads a comma separated list of origins, e.g. "https://example.com, https://example.org"
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// route is an entry of the route table, GET routes serve HEAD too
+type route struct {
+	pattern string
+	methods []string
+	handler http.HandlerFunc
+}
+
+func (s *server) routes() []route {
+	return []route{
+		{pattern: "/a/{target...}", methods: []string{http.MethodGet, http.MethodPost}, handler: s.handleApp},
+		{pattern: "/i/{target...}", methods: []string{http.MethodGet}, handler: s.handleIcon},
+		{pattern: apiAppsPrefix + "{target...}", methods: []string{http.MethodGet}, handler: s.handleAPIApp},
+	}
 }
 
 func (s *server) Router() http.HandlerFunc {
+	mux := http.NewServeMux()
+
+	for _, r := range s.routes() {
+		allow := allowedMethods(r.methods)
+		for _, method := range r.methods {
+			mux.HandleFunc(method+" "+r.pattern, s.withCORS(allow, withoutHeadBody(r.handler)))
+		}
+		mux.HandleFunc(http.MethodOptions+" "+r.pattern, s.withCORS(allow, handleOptions(allow)))
+	}
+
+	return mux.ServeHTTP
+}
+
+// allowedMethods is the Allow header of the route
+func allowedMethods(methods []string) string {
+	allowed := slices.Clone(methods)
+	if slices.Contains(methods, http.MethodGet) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	return strings.Join(append(allowed, http.MethodOptions), ", ")
+}
+
+func handleOptions(allow string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// withCORS answers requests of the allowed origins, preflight requests get the methods of the route
+func (s *server) withCORS(allow string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		// Parse URL path and query
-		urlPath := req.URL.Path
-		switch {
-		//case urlPath == "/favicon.ico":
-		//	s.handleFavicon(w)
-		case strings.HasPrefix(urlPath, "/a/"):
-			s.handleApp(w, req)
-		case strings.HasPrefix(urlPath, "/i/"):
-			s.handleIcon(w, req)
-		default:
-			// If the path is not in the expected format, return a default response
-			http.Error(w, "Invalid request format", http.StatusBadRequest)
+		if len(s.allowedOrigins) == 0 {
+			next(w, req)
 			return
 		}
+
+		allowed := s.allowedOrigin(req.Header.Get("Origin"))
+		if allowed != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if req.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", allow)
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+			}
+		}
+
+		next(w, req)
 	}
 }
+
+// allowedOrigin is the Access-Control-Allow-Origin value for the origin, empty if it's not allowed
+func (s *server) allowedOrigin(origin string) string {
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" {
+			return allowed
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withoutHeadBody drops the body of HEAD responses, not every runtime serving the router does it like net/http
+func withoutHeadBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w = headResponseWriter{ResponseWriter: w}
+		}
+		next(w, req)
+	}
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"github.com/nazar256/intopwa/internal/domain"
 	"github.com/nazar256/intopwa/internal/domain/server/mocks"
 	"github.com/stretchr/testify/assert"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -27,8 +29,8 @@ func TestRouter(t *testing.T) {
 			expectedContentType: "text/html",
 			expectedSubstrings: []string{
 				"<title>App for google.com</title>",
-				"/a/google.com/some/path/manifest.json?v=",
-				"/a/google.com/some/path/service-worker.js",
+				"/a/google.com/some/path/-/manifest.json?v=",
+				"/a/google.com/some/path/-/service-worker.js",
 				"/default-app-icon.png",
 			},
 			initMocks: func(fetcher *mocks.IconsFetcher) {
@@ -36,8 +38,8 @@ func TestRouter(t *testing.T) {
 				var iconURLs []*url.URL
 				fetcher.EXPECT().CacheIcons(mock.Anything, u, iconURLs).
 					Return(nil).Once()
-				fetcher.EXPECT().FetchIcons(mock.Anything, u).
-					Return(nil).Once()
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{}).Once()
 			},
 		},
 		{
@@ -67,17 +69,22 @@ func TestRouter(t *testing.T) {
 		{
 			name:           "Test invalid path",
 			url:            "/invalid/",
-			expectedStatus: http.StatusBadRequest,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Unknown file of the app",
+			url:            "/a/www.wikipedia.org/-/unknown.js",
+			expectedStatus: http.StatusNotFound,
 		},
 		{
 			name: "manifest",
-			url:  "/a/www.wikipedia.org/manifest.json",
+			url:  "/a/www.wikipedia.org/-/manifest.json",
 			initMocks: func(fetcher *mocks.IconsFetcher) {
 				u, _ := url.Parse("https://www.wikipedia.org")
 				iconU, _ := url.Parse("https://www.wikipedia.org/static/favicon.ico")
-				fetcher.EXPECT().FetchIcons(mock.Anything, u).
-					Return(
-						[]domain.Icon{{
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Icons: []domain.Icon{{
 							URL:  iconU,
 							Body: []byte{},
 							Props: domain.ImageProps{
@@ -88,7 +95,7 @@ func TestRouter(t *testing.T) {
 								},
 							},
 						}},
-					).Once()
+					}).Once()
 			},
 			expectedStatus:      http.StatusOK,
 			expectedContentType: "application/json",
@@ -96,21 +103,281 @@ func TestRouter(t *testing.T) {
 				"image/x-icon",
 				"64x64",
 				"/i/www.wikipedia.org/static/favicon.ico",
-				"\"/a/www.wikipedia.org/redirect.html\"",
+				"\"/a/www.wikipedia.org/-/redirect.html\"",
+			},
+		},
+		{
+			name: "manifest prefers site manifest values",
+			url:  "/a/www.wikipedia.org/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.wikipedia.org")
+				iconU, _ := url.Parse("https://www.wikipedia.org/static/maskable.png")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Icons: []domain.Icon{{
+							URL:     iconU,
+							Purpose: "maskable",
+							Props: domain.ImageProps{
+								MimeType: "image/png",
+								Size:     domain.ImageSize{Width: 512, Height: 512},
+							},
+						}},
+						Manifest: &domain.WebManifest{
+							Name:       "Wikipedia",
+							ShortName:  "Wiki",
+							ThemeColor: "#000000",
+							Display:    "browser",
+						},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"name":"Wikipedia"`,
+				`"short_name":"Wiki"`,
+				`"theme_color":"#000000"`,
+				`"background_color":"#3367D6"`,
+				`"display":"standalone"`,
+				`"purpose":"maskable"`,
+			},
+		},
+		{
+			name: "manifest is named after the page",
+			url:  "/a/mail.example.com/inbox/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://mail.example.com/inbox")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Metadata: domain.PageMetadata{
+							Title:       "Inbox (3) - Example Mail Service",
+							Description: "Mail for everyone",
+						},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"name":"Example Mail Service"`,
+				`"short_name":"Example Mail"`,
+				`"description":"Mail for everyone"`,
+			},
+		},
+		{
+			name: "manifest falls back to the URL",
+			url:  "/a/www.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"name":"www.example.com"`,
+				`"short_name":"example.com"`,
+			},
+		},
+		{
+			name: "manifest takes colors from the page",
+			url:  "/a/www.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Metadata: domain.PageMetadata{ThemeColor: "#112233", ThemeColorDark: "#000000"},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"theme_color":"#112233"`,
+				`"background_color":"#112233"`,
+			},
+		},
+		{
+			name: "manifest takes colors from the icon",
+			url:  "/a/www.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com")
+				iconU, _ := url.Parse("https://www.example.com/icon.png")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Icons: []domain.Icon{{
+							URL: iconU,
+							Props: domain.ImageProps{
+								MimeType:      "image/png",
+								Size:          domain.ImageSize{Width: 192, Height: 192},
+								DominantColor: "#e01010",
+							},
+						}},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"theme_color":"#e01010"`,
+				`"background_color":"#FFFFFF"`,
+			},
+		},
+		{
+			name: "app page uses the theme colors",
+			url:  "/a/www.example.com/",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com/")
+				var iconURLs []*url.URL
+				fetcher.EXPECT().CacheIcons(mock.Anything, u, iconURLs).
+					Return(nil).Once()
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Metadata: domain.PageMetadata{ThemeColor: "#112233", ThemeColorDark: "#000000"},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/html",
+			expectedSubstrings: []string{
+				`<meta name="theme-color" content="#112233"/>`,
+				`<meta name="theme-color" media="(prefers-color-scheme: dark)" content="#000000"/>`,
+			},
+		},
+		{
+			name: "manifest applies app settings",
+			url:  "/a/mail.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://mail.example.com")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Manifest: &domain.WebManifest{Name: "Example Mail", ThemeColor: "#ff0000"},
+						Settings: domain.AppSettings{
+							Name:        "My Mail",
+							Display:     "fullscreen",
+							Orientation: "portrait",
+							ThemeColor:  "#112233",
+							StartPath:   "/inbox?tab=1",
+						},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`"name":"My Mail"`,
+				`"short_name":"My Mail"`,
+				`"display":"fullscreen"`,
+				`"orientation":"portrait"`,
+				`"theme_color":"#112233"`,
+				`"start_url":"/a/mail.example.com/inbox/-/redirect.html?tab=1"`,
+			},
+		},
+		{
+			name: "manifest adds maskable variants on the theme color",
+			url:  "/a/www.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com")
+				iconU, _ := url.Parse("https://www.example.com/icon.svg")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Icons: []domain.Icon{{
+							URL: iconU,
+							Props: domain.ImageProps{
+								MimeType: "image/svg+xml",
+								Size:     domain.ImageSize{Width: 24, Height: 24},
+							},
+						}},
+						Metadata: domain.PageMetadata{ThemeColor: "#112233"},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`{"src":"/i/www.example.com/icon.svg","type":"image/svg+xml","sizes":"any","purpose":"any"}`,
+				`{"src":"/i/www.example.com/icon.svg?intopwa-mask=112233\u0026intopwa-size=192","type":"image/png","sizes":"192x192","purpose":"maskable"}`,
+				`{"src":"/i/www.example.com/icon.svg?intopwa-mask=112233\u0026intopwa-size=512","type":"image/png","sizes":"512x512","purpose":"maskable"}`,
+			},
+		},
+		{
+			name: "manifest lists every icon size",
+			url:  "/a/www.example.com/-/manifest.json",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.example.com")
+				icoU, _ := url.Parse("https://www.example.com/favicon.ico")
+				monoU, _ := url.Parse("https://www.example.com/mono.png")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{
+						Icons: []domain.Icon{
+							{
+								URL: icoU,
+								Props: domain.ImageProps{
+									MimeType: "image/x-icon",
+									Size:     domain.ImageSize{Width: 48, Height: 48},
+									Sizes: []domain.ImageSize{
+										{Width: 48, Height: 48},
+										{Width: 16, Height: 16},
+									},
+								},
+							},
+							{
+								URL:     monoU,
+								Purpose: "monochrome",
+								Props: domain.ImageProps{
+									MimeType: "image/png",
+									Size:     domain.ImageSize{Width: 96, Height: 96},
+								},
+							},
+						},
+					}).Once()
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedSubstrings: []string{
+				`{"src":"/i/www.example.com/favicon.ico","type":"image/x-icon","sizes":"48x48 16x16","purpose":"any"}`,
+				`{"src":"/i/www.example.com/mono.png","type":"image/png","sizes":"96x96","purpose":"monochrome"}`,
 			},
 		},
 		{
 			name:                "service workers",
-			url:                 "/a/www.wikipedia.org/service-worker.js",
+			url:                 "/a/www.wikipedia.org/-/service-worker.js",
 			expectedStatus:      http.StatusOK,
 			expectedContentType: "application/javascript",
 			expectedSubstrings: []string{
 				"addEventListener",
+				`const CACHE_PREFIX = "intopwa:/a/www.wikipedia.org";`,
+				`const STRATEGY = "network-first";`,
+				`const OFFLINE_URL = "/a/www.wikipedia.org/-/offline.html";`,
+				`const PRECACHE_URLS = ["/a/www.wikipedia.org/-/redirect.html","/a/www.wikipedia.org/-/offline.html"];`,
+			},
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://www.wikipedia.org")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{}).Once()
+			},
+		},
+		{
+			name:                "service worker with chosen strategy",
+			url:                 "/a/mail.example.com/inbox/-/service-worker.js",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/javascript",
+			expectedSubstrings: []string{
+				`const STRATEGY = "stale-while-revalidate";`,
+				`"intopwa:/a/mail.example.com/inbox"`,
+			},
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				u, _ := url.Parse("https://mail.example.com/inbox")
+				fetcher.EXPECT().FetchApp(mock.Anything, u).
+					Return(domain.App{Settings: domain.AppSettings{CacheStrategy: domain.StrategyStaleWhileRevalidate}}).Once()
+			},
+		},
+		{
+			name:                "offline page",
+			url:                 "/a/www.wikipedia.org/-/offline.html",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/html",
+			expectedSubstrings: []string{
+				"<title>www.wikipedia.org is offline</title>",
+				`<a href="/a/www.wikipedia.org/-/redirect.html">`,
 			},
 		},
 		{
 			name:                "redirect page",
-			url:                 "/a/familylink.google.com/redirect.html",
+			url:                 "/a/familylink.google.com/-/redirect.html",
 			expectedStatus:      http.StatusOK,
 			expectedContentType: "text/html",
 			expectedSubstrings: []string{
@@ -151,3 +418,293 @@ func TestRouter(t *testing.T) {
 		})
 	}
 }
+
+func TestRouterStoresAppSettings(t *testing.T) {
+	u, _ := url.Parse("https://mail.example.com/")
+	form := url.Values{
+		"name":        {"My Mail"},
+		"display":     {"minimal-ui"},
+		"theme_color": {"#112233"},
+	}
+
+	iconsFetcherMock := mocks.NewIconsFetcher(t)
+	var iconURLs []*url.URL
+	iconsFetcherMock.EXPECT().StoreSettings(u, domain.AppSettings{
+		Name:       "My Mail",
+		Display:    "minimal-ui",
+		ThemeColor: "#112233",
+	}).Return(nil).Once()
+	iconsFetcherMock.EXPECT().CacheIcons(mock.Anything, u, iconURLs).Return(nil).Once()
+	iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{}).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/a/mail.example.com/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	New(iconsFetcherMock).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRouterRejectsInvalidAppSettings(t *testing.T) {
+	form := url.Values{"display": {"window"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/a/mail.example.com/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	New(mocks.NewIconsFetcher(t)).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unsupported display")
+}
+
+func TestRouterRetriesFailedPage(t *testing.T) {
+	u, _ := url.Parse("https://example.com")
+
+	iconsFetcherMock := mocks.NewIconsFetcher(t)
+	iconsFetcherMock.EXPECT().ForgetFailure(u).Return(nil).Once()
+	iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{}).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/a/example.com/-/manifest.json?refresh=1", nil)
+	rr := httptest.NewRecorder()
+
+	New(iconsFetcherMock).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRouterDescribesApp(t *testing.T) {
+	u, _ := url.Parse("https://example.com/app")
+	iconURL, _ := url.Parse("https://example.com/icon-192.png")
+	missingURL, _ := url.Parse("https://example.com/icon-512.png")
+
+	iconsFetcherMock := mocks.NewIconsFetcher(t)
+	iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{
+		Identity: u,
+		Metadata: domain.PageMetadata{Title: "Example"},
+		IconLinks: []domain.IconLink{
+			{URL: iconURL, Sizes: "192x192", Type: "image/png", Rel: "icon"},
+			{URL: missingURL, Sizes: "512x512", Type: "image/png", Rel: "icon"},
+		},
+		Icons: []domain.Icon{{
+			URL:   iconURL,
+			Props: domain.ImageProps{MimeType: "image/png", Size: domain.ImageSize{Width: 192, Height: 192}},
+		}},
+		Failure: &domain.ScrapeFailure{Reason: domain.FailureStatus, Status: 503},
+	}).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/apps/example.com/app", nil)
+	rr := httptest.NewRecorder()
+
+	New(iconsFetcherMock).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var described apiApp
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &described))
+	assert.Equal(t, "https://example.com/app", described.Identity)
+	assert.Equal(t, "/a/example.com/app", described.Paths.Page)
+	assert.Equal(t, "Example", described.Metadata.Title)
+	assert.NotEmpty(t, described.ManifestVersion)
+	assert.Contains(t, described.Paths.Manifest, described.ManifestVersion)
+	assert.Equal(t, []apiIcon{
+		{
+			SourceURL: "https://example.com/icon-192.png", Rel: "icon", Sizes: "192x192", Type: "image/png",
+			Cached: true, Path: "/i/example.com/icon-192.png", MimeType: "image/png", ImageSize: "192x192",
+		},
+		{SourceURL: "https://example.com/icon-512.png", Rel: "icon", Sizes: "512x512", Type: "image/png"},
+	}, described.Icons)
+	if assert.NotNil(t, described.Error) {
+		assert.Equal(t, domain.FailureStatus, described.Error.Reason)
+		assert.Equal(t, 503, described.Error.Status)
+	}
+}
+
+func TestRouterRejectsAPIWrites(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/apps/example.com/", nil)
+	rr := httptest.NewRecorder()
+
+	New(mocks.NewIconsFetcher(t)).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+}
+
+func TestRouterServesSitePathsNamedLikeAppFiles(t *testing.T) {
+	u, _ := url.Parse("https://example.com/api/manifest.json")
+
+	iconsFetcherMock := mocks.NewIconsFetcher(t)
+	var iconURLs []*url.URL
+	iconsFetcherMock.EXPECT().CacheIcons(mock.Anything, u, iconURLs).Return(nil).Once()
+	iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{}).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/a/example.com/api/manifest.json/-/", nil)
+	rr := httptest.NewRecorder()
+
+	New(iconsFetcherMock).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "/a/example.com/api/manifest.json/-/manifest.json?v=")
+}
+
+func TestRouterServesLegacyAppFiles(t *testing.T) {
+	tests := []struct {
+		name                string
+		url                 string
+		fetchesApp          bool
+		expectedContentType string
+		expectedSubstrings  []string
+	}{
+		{
+			name:                "Manifest keeps the start URL of installed apps",
+			url:                 "/a/mail.example.com/inbox/manifest.json?v=123",
+			fetchesApp:          true,
+			expectedContentType: "application/json",
+			expectedSubstrings:  []string{`"start_url":"/a/mail.example.com/inbox/redirect.html"`},
+		},
+		{
+			name:                "Service worker",
+			url:                 "/a/mail.example.com/inbox/service-worker.js",
+			fetchesApp:          true,
+			expectedContentType: "application/javascript",
+			expectedSubstrings:  []string{`const OFFLINE_URL = "/a/mail.example.com/inbox/-/offline.html";`},
+		},
+		{
+			name:                "Start URL",
+			url:                 "/a/mail.example.com/inbox/redirect.html",
+			expectedContentType: "text/html",
+			expectedSubstrings:  []string{`https://mail.example.com/inbox`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iconsFetcherMock := mocks.NewIconsFetcher(t)
+			if tt.fetchesApp {
+				u, _ := url.Parse("https://mail.example.com/inbox")
+				iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{}).Once()
+			}
+
+			rr := httptest.NewRecorder()
+			New(iconsFetcherMock).Router().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expectedContentType, rr.Header().Get("Content-Type"))
+			for _, expectedSubstr := range tt.expectedSubstrings {
+				assert.Contains(t, rr.Body.String(), expectedSubstr)
+			}
+		})
+	}
+}
+
+func TestRouterServesHeadWithoutBody(t *testing.T) {
+	u, _ := url.Parse("https://example.com")
+
+	iconsFetcherMock := mocks.NewIconsFetcher(t)
+	iconsFetcherMock.EXPECT().FetchApp(mock.Anything, u).Return(domain.App{}).Once()
+
+	req := httptest.NewRequest(http.MethodHead, "/a/example.com/-/manifest.json", nil)
+	rr := httptest.NewRecorder()
+
+	New(iconsFetcherMock).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestRouterRejectsPostToAppFiles(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/a/example.com/-/manifest.json", nil)
+	rr := httptest.NewRecorder()
+
+	New(mocks.NewIconsFetcher(t)).Router().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+}
+
+func TestRouterCORS(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		allowedOrigins []string
+		expectedOrigin string
+		expectedVary   string
+		expectedStatus int
+	}{
+		{
+			name:           "Preflight of an allowed origin",
+			method:         http.MethodOptions,
+			origin:         "https://into-progressive.web.app",
+			allowedOrigins: []string{"https://into-progressive.web.app"},
+			expectedOrigin: "https://into-progressive.web.app",
+			expectedVary:   "Origin",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Preflight of another origin",
+			method:         http.MethodOptions,
+			origin:         "https://evil.example.com",
+			allowedOrigins: []string{"https://into-progressive.web.app"},
+			expectedVary:   "Origin",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Any origin",
+			method:         http.MethodOptions,
+			origin:         "https://example.com",
+			allowedOrigins: []string{"*"},
+			expectedOrigin: "*",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "CORS disabled",
+			method:         http.MethodOptions,
+			origin:         "https://example.com",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Request of an allowed origin",
+			method:         http.MethodGet,
+			origin:         "https://into-progressive.web.app",
+			allowedOrigins: []string{"https://into-progressive.web.app"},
+			expectedOrigin: "https://into-progressive.web.app",
+			expectedVary:   "Origin",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iconsFetcherMock := mocks.NewIconsFetcher(t)
+			if tt.method == http.MethodGet {
+				iconsFetcherMock.EXPECT().FetchApp(mock.Anything, mock.Anything).Return(domain.App{}).Once()
+			}
+
+			req := httptest.NewRequest(tt.method, "/api/v1/apps/example.com/", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+
+			New(iconsFetcherMock, WithAllowedOrigins(tt.allowedOrigins...)).Router().ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectedVary, rr.Header().Get("Vary"))
+			if tt.method == http.MethodOptions {
+				assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+			}
+			if tt.method == http.MethodOptions && tt.expectedOrigin != "" {
+				assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	assert.Equal(t, []string{"https://example.com", "*"}, ParseOrigins(" https://example.com/, ,* "))
+	assert.Empty(t, ParseOrigins(""))
+}
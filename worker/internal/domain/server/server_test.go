@@ -10,10 +10,15 @@ import (
 	"github.com/nazar256/intopwa/internal/domain/server"
 	cache_icons "github.com/nazar256/intopwa/internal/pkg/caching/icons"
 	"github.com/nazar256/intopwa/internal/pkg/caching/links"
+	"github.com/nazar256/intopwa/internal/pkg/caching/settings"
 	"github.com/nazar256/intopwa/internal/pkg/scrape"
+	"github.com/nazar256/intopwa/internal/pkg/urlpolicy"
+	"github.com/nazar256/intopwa/pkg/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"html"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -32,9 +37,10 @@ type PwaManifest struct {
 }
 
 type PwaIcon struct {
-	Src   string `json:"src"`
-	Type  string `json:"type"`
-	Sizes string `json:"sizes"`
+	Src     string `json:"src"`
+	Type    string `json:"type"`
+	Sizes   string `json:"sizes"`
+	Purpose string `json:"purpose,omitempty"`
 }
 
 func TestServer(t *testing.T) {
@@ -180,14 +186,19 @@ func TestServer(t *testing.T) {
 				Name: "relay.firefox.com/accounts/profile",
 				Icons: []PwaIcon{
 					{
-						Src:   "/i/relay.firefox.com/favicon.svg",
-						Type:  "image/svg+xml",
+						Src:   "/i/relay.firefox.com/favicon.svg?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
+					{
+						Src:   "/i/relay.firefox.com/favicon.svg?intopwa-size=512",
+						Type:  "image/png",
 						Sizes: "512x512",
 					},
 					{
 						Src:   "/i/relay.firefox.com/favicon.svg",
 						Type:  "image/svg+xml",
-						Sizes: "70x77",
+						Sizes: "any",
 					},
 				},
 			},
@@ -202,11 +213,16 @@ func TestServer(t *testing.T) {
 					{
 						Src:   "/i/raw.githubusercontent.com/simple-icons/simple-icons/develop/icons/epicgames.svg",
 						Type:  "image/svg+xml",
-						Sizes: "24x24",
+						Sizes: "any",
 					},
 					{
-						Src:   "/i/raw.githubusercontent.com/simple-icons/simple-icons/develop/icons/epicgames.svg",
-						Type:  "image/svg+xml",
+						Src:   "/i/raw.githubusercontent.com/simple-icons/simple-icons/develop/icons/epicgames.svg?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
+					{
+						Src:   "/i/raw.githubusercontent.com/simple-icons/simple-icons/develop/icons/epicgames.svg?intopwa-size=512",
+						Type:  "image/png",
 						Sizes: "512x512",
 					},
 					{
@@ -227,7 +243,12 @@ func TestServer(t *testing.T) {
 					{
 						Src:   "/i/raw.githubusercontent.com/edent/SuperTinyIcons/master/images/svg/udemy.svg",
 						Type:  "image/svg+xml",
-						Sizes: "512x512",
+						Sizes: "any",
+					},
+					{
+						Src:   "/i/raw.githubusercontent.com/edent/SuperTinyIcons/master/images/svg/udemy.svg?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
 					},
 				},
 			},
@@ -245,7 +266,12 @@ func TestServer(t *testing.T) {
 						Sizes: "256x256",
 					},
 					{
-						Src:   "/i/cdn-icons-png.flaticon.com/256/732/732242.png",
+						Src:   "/i/cdn-icons-png.flaticon.com/256/732/732242.png?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
+					{
+						Src:   "/i/cdn-icons-png.flaticon.com/256/732/732242.png?intopwa-size=512",
 						Type:  "image/png",
 						Sizes: "512x512",
 					},
@@ -264,6 +290,11 @@ func TestServer(t *testing.T) {
 						Type:  "image/png",
 						Sizes: "512x512",
 					},
+					{
+						Src:   "/i/pngimg.com/d/chatgpt_PNG14.png?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
 				},
 			},
 		},
@@ -280,7 +311,12 @@ func TestServer(t *testing.T) {
 						Sizes: "1279x1280",
 					},
 					{
-						Src:   "/i/cdn.pixabay.com/photo/2023/05/08/00/43/chatgpt-7977357_1280.png",
+						Src:   "/i/cdn.pixabay.com/photo/2023/05/08/00/43/chatgpt-7977357_1280.png?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
+					{
+						Src:   "/i/cdn.pixabay.com/photo/2023/05/08/00/43/chatgpt-7977357_1280.png?intopwa-size=512",
 						Type:  "image/png",
 						Sizes: "512x512",
 					},
@@ -300,7 +336,12 @@ func TestServer(t *testing.T) {
 						Sizes: "600x600",
 					},
 					{
-						Src:   "/i/images.seeklogo.com/logo-png/46/1/chatgpt-logo-png_seeklogo-465219.png",
+						Src:   "/i/images.seeklogo.com/logo-png/46/1/chatgpt-logo-png_seeklogo-465219.png?intopwa-size=192",
+						Type:  "image/png",
+						Sizes: "192x192",
+					},
+					{
+						Src:   "/i/images.seeklogo.com/logo-png/46/1/chatgpt-logo-png_seeklogo-465219.png?intopwa-size=512",
 						Type:  "image/png",
 						Sizes: "512x512",
 					},
@@ -309,10 +350,13 @@ func TestServer(t *testing.T) {
 		},
 	}
 
-	scraper := scrape.NewIconsScraper(new(http.Client))
-	iconsCache := cache_icons.NewCache(newMemKV())
-	assetsCache := links.NewCache(newMemKV())
-	iconsFetcher := icons.NewIconsFetcher(scraper, iconsCache, assetsCache)
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	scraper := scrape.NewIconsScraper(urlpolicy.NewClient(noRedirects, urlpolicy.DefaultPolicy(), net.DefaultResolver))
+	iconsCache := cache_icons.NewCache(newMemKV(), storage.NewKVBlobs(newMemKV()))
+	assetsCache := links.NewCache(newMemKV(), newMemKV())
+	iconsFetcher := icons.NewIconsFetcher(scraper, iconsCache, assetsCache, settings.NewCache(newMemKV()))
 	app := server.New(iconsFetcher)
 
 	srv := httptest.NewServer(app.Router())
@@ -377,15 +421,15 @@ func assertAppPage(t *testing.T, resp *http.Response, expectedTitle string) (man
 	manifestRegex := regexp.MustCompile(`<link rel="manifest" href="(.+?)">`)
 	matches := manifestRegex.FindStringSubmatch(string(body))
 	require.Len(t, matches, 2)
-	manifestUrlStr := matches[1]
+	manifestUrlStr := html.UnescapeString(matches[1])
 
 	manifestUrl, err = url.Parse(manifestUrlStr)
 	require.NoError(t, err)
 
-	serviceWorkerRegex := regexp.MustCompile(`<script>\s+if \('serviceWorker' in navigator\) {\s+navigator.serviceWorker.register\('(.+?)'\)`)
+	serviceWorkerRegex := regexp.MustCompile(`<script data-service-worker="(.+?)"`)
 	matches = serviceWorkerRegex.FindStringSubmatch(string(body))
 	require.Len(t, matches, 2)
-	serviceWorkerURLStr := matches[1]
+	serviceWorkerURLStr := html.UnescapeString(matches[1])
 
 	serviceWorkerURL, err = url.Parse(serviceWorkerURLStr)
 	require.NoError(t, err)
@@ -419,7 +463,19 @@ func assertManifest(t *testing.T, resp *http.Response, expectedManifest PwaManif
 
 	assert.Equal(t, expectedManifest.Name, manifest.Name)
 
-	require.LessOrEqual(t, len(manifest.Icons), len(expectedManifest.Icons))
+	// maskable variants are padded on the site's theme color, so only their presence is checked
+	var anyIcons, maskableIcons []PwaIcon
+	for _, icon := range manifest.Icons {
+		if icon.Purpose == "maskable" {
+			maskableIcons = append(maskableIcons, icon)
+			continue
+		}
+		anyIcons = append(anyIcons, icon)
+	}
+	require.LessOrEqual(t, len(anyIcons), len(expectedManifest.Icons))
+	if len(expectedManifest.Icons) > 0 {
+		assert.NotNil(t, findIcon(maskableIcons, "", "512x512"))
+	}
 
 	for _, expectedIcon := range expectedManifest.Icons {
 		icon := findIcon(manifest.Icons, expectedIcon.Src, expectedIcon.Sizes)
@@ -438,7 +494,7 @@ func assertManifest(t *testing.T, resp *http.Response, expectedManifest PwaManif
 
 func findIcon(icons []PwaIcon, src, sizes string) *PwaIcon {
 	for _, icon := range icons {
-		if icon.Src == src && (icon.Sizes == sizes || sizes == "") {
+		if (icon.Src == src || src == "") && (icon.Sizes == sizes || sizes == "") {
 			return &icon
 		}
 	}
@@ -483,3 +539,8 @@ func (m *memKV) Put(key string, value []byte) error {
 	m.icons[key] = value
 	return nil
 }
+
+func (m *memKV) Delete(key string) error {
+	delete(m.icons, key)
+	return nil
+}
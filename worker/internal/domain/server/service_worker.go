@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// cacheNamePrefix namespaces caches of the apps, they all share the origin of the worker
+	cacheNamePrefix = "intopwa:"
+	// cacheVersionLength is enough of the manifest version to tell cache generations apart
+	cacheVersionLength = 16
+)
+
+// serviceWorkerData fills the app's service worker, see templates/service-worker.js.
+// The cache name ends with the manifest version, so a changed app installs a new worker dropping the old caches.
+type serviceWorkerData struct {
+	CachePrefix string
+	Version     string
+	Strategy    string
+	OfflinePath string
+	Precache    []string
+}
+
+func (s *server) handleServiceWorker(ctx context.Context, w http.ResponseWriter, u *appURL) {
+	manifest, version := s.buildManifest(ctx, u)
+
+	data := serviceWorkerData{
+		CachePrefix: cacheNamePrefix + u.appPath() + u.querySuffix(),
+		Version:     version[:cacheVersionLength],
+		Strategy:    manifest.strategy,
+		OfflinePath: u.offlinePagePath(),
+		Precache:    []string{u.redirectPagePath(), u.offlinePagePath()},
+	}
+
+	// browsers compare the script on every check, so updates of the app reach installed workers
+	w.Header().Set("Cache-Control", "no-cache")
+	// the worker lives under the app's files, but controls the app's start URLs too
+	w.Header().Set("Service-Worker-Allowed", u.scopePath())
+	renderTemplate(w, serviceWorkerTemplate, "application/javascript", data)
+}
+
+// offlinePageData fills the page shown without a network, see templates/offline.html
+type offlinePageData struct {
+	Name      string
+	RetryPath string
+}
+
+// handleOfflinePage renders the page the service worker shows when the app is opened without a network
+func (s *server) handleOfflinePage(w http.ResponseWriter, u *appURL) {
+	renderTemplate(w, offlinePageTemplate, "text/html", offlinePageData{
+		Name:      u.Hostname(),
+		RetryPath: u.redirectPagePath(),
+	})
+}
+
+// jsonLiteral encodes the value for the script, JSON escapes <, > and & so it can't close a script tag either
+func jsonLiteral(v any) (string, error) {
+	literal, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode script value: %w", err)
+	}
+	return string(literal), nil
+}
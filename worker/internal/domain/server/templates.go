@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"text/template"
+)
+
+// defaultTemplates are the pages and the service worker served for apps
+//
+//go:embed templates/*.html templates/*.js
+var defaultTemplates embed.FS
+
+var (
+	appPageTemplate       = parseHTMLTemplate("app.html")
+	redirectPageTemplate  = parseHTMLTemplate("redirect.html")
+	offlinePageTemplate   = parseHTMLTemplate("offline.html")
+	serviceWorkerTemplate = parseScriptTemplate("service-worker.js")
+)
+
+// parseHTMLTemplate parses a page, values are escaped for the context they are put in
+func parseHTMLTemplate(name string) *htmltemplate.Template {
+	return htmltemplate.Must(htmltemplate.New(name).Parse(readTemplate(name)))
+}
+
+// parseScriptTemplate parses a script, values are put in with the json function as JS literals
+func parseScriptTemplate(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(template.FuncMap{"json": jsonLiteral}).Parse(readTemplate(name)))
+}
+
+// readTemplate returns the template overridden at build time or the default one,
+// a broken override fails the start rather than serving unbranded pages
+func readTemplate(name string) string {
+	if templateOverrides != nil {
+		content, err := fs.ReadFile(templateOverrides, name)
+		if err == nil {
+			return string(content)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			panic(fmt.Sprintf("failed to read template override %s: %v", name, err))
+		}
+	}
+
+	content, err := defaultTemplates.ReadFile(path.Join("templates", name))
+	if err != nil {
+		panic(fmt.Sprintf("failed to read template %s: %v", name, err))
+	}
+
+	return string(content)
+}
+
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// renderTemplate renders the whole response before writing it, so a failing template doesn't leave a half-written page
+func renderTemplate(w http.ResponseWriter, tmpl templateExecutor, contentType string, data any) {
+	var body bytes.Buffer
+	err := tmpl.Execute(&body, data)
+	if err != nil {
+		slog.Error("failed to render template", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err = body.WriteTo(w)
+	if err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,64 @@
+const CACHE_PREFIX = {{json .CachePrefix}};
+const CACHE_NAME = CACHE_PREFIX + ':' + {{json .Version}};
+const STRATEGY = {{json .Strategy}};
+const OFFLINE_URL = {{json .OfflinePath}};
+const PRECACHE_URLS = {{json .Precache}};
+
+self.addEventListener('install', event => {
+	event.waitUntil(
+		caches.open(CACHE_NAME)
+			.then(cache => cache.addAll(PRECACHE_URLS))
+			.then(() => self.skipWaiting())
+	);
+});
+
+self.addEventListener('activate', event => {
+	// caches of other apps on the origin are kept, only older generations of this app are deleted
+	event.waitUntil(
+		caches.keys()
+			.then(keys => Promise.all(keys
+				.filter(key => key !== CACHE_NAME && key.slice(0, key.lastIndexOf(':')) === CACHE_PREFIX)
+				.map(key => caches.delete(key))))
+			.then(() => self.clients.claim())
+	);
+});
+
+function fromCache(request) {
+	return caches.open(CACHE_NAME).then(cache => cache.match(request));
+}
+
+function fromNetwork(request) {
+	return fetch(request).then(response => {
+		if (response.ok) {
+			const copy = response.clone();
+			caches.open(CACHE_NAME).then(cache => cache.put(request, copy));
+		}
+		return response;
+	});
+}
+
+const strategies = {
+	'network-first': event => fromNetwork(event.request)
+		.catch(error => fromCache(event.request).then(cached => cached || Promise.reject(error))),
+	'cache-first': event => fromCache(event.request)
+		.then(cached => cached || fromNetwork(event.request)),
+	'stale-while-revalidate': event => {
+		const network = fromNetwork(event.request);
+		event.waitUntil(network.catch(() => undefined));
+		return fromCache(event.request).then(cached => cached || network);
+	},
+};
+
+self.addEventListener('fetch', event => {
+	if (event.request.method !== 'GET') {
+		return;
+	}
+
+	const strategy = strategies[STRATEGY] || strategies['network-first'];
+	event.respondWith(strategy(event).catch(error => {
+		if (event.request.mode !== 'navigate') {
+			throw error;
+		}
+		return fromCache(OFFLINE_URL).then(offline => offline || Promise.reject(error));
+	}));
+});
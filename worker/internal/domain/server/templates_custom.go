@@ -0,0 +1,23 @@
+//go:build custom_templates
+
+package server
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// customTemplates replace the default templates of the same name, e.g. templates/custom/app.html
+//
+//go:embed templates/custom
+var customTemplates embed.FS
+
+var templateOverrides = mustSub(customTemplates, "templates/custom")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,8 @@
+//go:build !custom_templates
+
+package server
+
+import "io/fs"
+
+// templateOverrides are empty unless built with the custom_templates tag
+var templateOverrides fs.FS
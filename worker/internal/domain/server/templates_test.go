@@ -0,0 +1,174 @@
+package server
+
+import (
+	"flag"
+	"github.com/nazar256/intopwa/internal/domain"
+	"github.com/nazar256/intopwa/internal/domain/server/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with the rendered output")
+
+func TestTemplatesGolden(t *testing.T) {
+	iconU, _ := url.Parse("https://mail.example.com/icon.png")
+	app := domain.App{
+		Icons: []domain.Icon{{
+			URL: iconU,
+			Props: domain.ImageProps{
+				MimeType: "image/png",
+				Size:     domain.ImageSize{Width: 192, Height: 192},
+			},
+		}},
+		Metadata: domain.PageMetadata{Title: "Mail", ThemeColor: "#112233", ThemeColorDark: "#000000"},
+		Settings: domain.AppSettings{CacheStrategy: domain.StrategyCacheFirst},
+	}
+
+	tests := []struct {
+		golden    string
+		url       string
+		initMocks func(fetcher *mocks.IconsFetcher)
+	}{
+		{
+			golden: "app.html.golden",
+			url:    "/a/mail.example.com/inbox?tab=1",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				var iconURLs []*url.URL
+				fetcher.EXPECT().CacheIcons(mock.Anything, mock.Anything, iconURLs).Return(nil).Once()
+				fetcher.EXPECT().FetchApp(mock.Anything, mock.Anything).Return(app).Once()
+			},
+		},
+		{
+			// markup in the query must not break out of the meta refresh
+			golden: "redirect.html.golden",
+			url:    `/a/mail.example.com/inbox/-/redirect.html?q="><script>alert(1)</script>`,
+		},
+		{
+			golden: "offline.html.golden",
+			url:    "/a/mail.example.com/inbox/-/offline.html?tab=1",
+		},
+		{
+			golden: "service-worker.js.golden",
+			url:    "/a/mail.example.com/inbox/-/service-worker.js?tab=1",
+			initMocks: func(fetcher *mocks.IconsFetcher) {
+				fetcher.EXPECT().FetchApp(mock.Anything, mock.Anything).Return(app).Once()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			fetcher := mocks.NewIconsFetcher(t)
+			if tt.initMocks != nil {
+				tt.initMocks(fetcher)
+			}
+
+			rr := httptest.NewRecorder()
+			New(fetcher).Router().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			goldenPath := filepath.Join("tests", "golden", tt.golden)
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(goldenPath, rr.Body.Bytes(), 0o644))
+			}
+
+			expected, err := os.ReadFile(goldenPath)
+			require.NoError(t, err, "run the test with -update to create the golden file")
+			assert.Equal(t, string(expected), rr.Body.String())
+		})
+	}
+}
+
+func TestTemplatesEscapeData(t *testing.T) {
+	const markup = `"><script>alert(1)</script>`
+
+	tests := []struct {
+		name     string
+		render   func(w http.ResponseWriter)
+		expected []string
+	}{
+		{
+			name: "redirect page",
+			render: func(w http.ResponseWriter) {
+				renderTemplate(w, redirectPageTemplate, "text/html", redirectPageData{URL: "https://example.com/" + markup})
+			},
+			expected: []string{
+				`content="0;url=https://example.com/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`,
+				`href="https://example.com/%22%3e%3cscript%3ealert%281%29%3c/script%3e"`,
+				`>https://example.com/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</a>`,
+			},
+		},
+		{
+			name: "offline page",
+			render: func(w http.ResponseWriter) {
+				renderTemplate(w, offlinePageTemplate, "text/html", offlinePageData{Name: markup, RetryPath: "/a/example.com/" + markup})
+			},
+			expected: []string{
+				`<title>&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt; is offline</title>`,
+				`href="/a/example.com/%22%3e%3cscript%3ealert%281%29%3c/script%3e"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.render(rr)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.NotContains(t, rr.Body.String(), "<script>")
+			for _, expected := range tt.expected {
+				assert.Contains(t, rr.Body.String(), expected)
+			}
+		})
+	}
+}
+
+func TestTemplatesRenderFunctionalColors(t *testing.T) {
+	tests := []struct {
+		name       string
+		theme      string
+		background string
+		expected   []string
+	}{
+		{
+			name:       "functional notations",
+			theme:      "rgb(17, 34, 51)",
+			background: "hsl(120 50% 50%)",
+			expected: []string{
+				`style="background-color: rgb(17, 34, 51)"`,
+				`style="background-color: hsl(120 50% 50%)"`,
+			},
+		},
+		{
+			name:       "not a color",
+			theme:      "url(//example.com/x)",
+			background: `red;background-image:url(x)`,
+			expected:   []string{`style="background-color: "`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			renderTemplate(rr, appPageTemplate, "text/html", appPageData{
+				Manifest:         pwaManifest{ThemeColor: tt.theme, BackgroundColor: tt.background},
+				ThemeSwatch:      swatch(tt.theme),
+				BackgroundSwatch: swatch(tt.background),
+			})
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.NotContains(t, rr.Body.String(), "ZgotmplZ")
+			for _, expected := range tt.expected {
+				assert.Contains(t, rr.Body.String(), expected)
+			}
+		})
+	}
+}
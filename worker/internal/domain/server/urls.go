@@ -1,45 +1,70 @@
 package server
 
 import (
+	"github.com/nazar256/intopwa/internal/domain"
 	"net/url"
 	"strings"
 )
 
 type appURL struct {
 	url.URL
+	// refresh asks to retry the page even if it failed to scrape recently
+	refresh bool
+	// resource is the requested file of the app, e.g. /manifest.json, empty for the app page
+	resource string
+	// legacy is set for files requested by their path before the resource segment
+	legacy bool
 }
 
 func (u *appURL) appPath() string {
-	pathParts := []string{"/a/", u.Hostname()}
+	pathParts := []string{"/a/", domain.SchemePathPrefix(&u.URL), u.Hostname()}
 	if u.Port() != "" {
 		pathParts = append(pathParts, ":", u.Port())
 	}
 
-	pathParts = append(pathParts, strings.TrimSuffix(u.Path, "/"))
+	pathParts = append(pathParts, escapeSitePath(strings.TrimSuffix(u.Path, "/")))
 
 	return strings.Join(pathParts, "")
 }
 
-func (u *appURL) redirectPagePath() string {
-	path := u.appPath() + redirectPagePath
-	if u.RawQuery != "" {
-		path += "?" + u.RawQuery
+// pagePath is the path of the app page, site paths ending in a file name of the app are marked with the resource segment
+func (u *appURL) pagePath() string {
+	if isLegacyFile(strings.TrimSuffix(u.Path, "/")) {
+		return u.appPath() + "/" + resourceSegment + appPageResource + u.querySuffix()
 	}
-	return path
+	return u.appPath() + u.querySuffix()
 }
 
-func (u *appURL) manifestPath() string {
-	path := u.appPath() + manifestPath
-	if u.RawQuery != "" {
-		path += "?" + u.RawQuery
+// querySuffix keeps apps differing only in the query apart
+func (u *appURL) querySuffix() string {
+	if u.RawQuery == "" {
+		return ""
 	}
-	return path
+	return "?" + u.RawQuery
+}
+
+// scopePath is the service worker scope, it covers the app's files and start URLs of the site's subpaths
+func (u *appURL) scopePath() string {
+	return u.appPath() + "/"
+}
+
+// resourcePath is the path of the app's file, e.g. /a/example.com/app/-/manifest.json
+func (u *appURL) resourcePath(resource string) string {
+	return u.appPath() + "/" + resourceSegment + resource + u.querySuffix()
+}
+
+func (u *appURL) redirectPagePath() string {
+	return u.resourcePath(redirectPagePath)
+}
+
+func (u *appURL) offlinePagePath() string {
+	return u.resourcePath(offlinePagePath)
+}
+
+func (u *appURL) manifestPath() string {
+	return u.resourcePath(manifestPath)
 }
 
 func (u *appURL) serviceWorkerPath() string {
-	path := u.appPath() + serviceWorkerPath
-	if u.RawQuery != "" {
-		path += "?" + u.RawQuery
-	}
-	return path
+	return u.resourcePath(serviceWorkerPath)
 }
@@ -9,7 +9,43 @@ import (
 func TestAppURLPathsIncludeQuery(t *testing.T) {
 	u := &appURL{URL: url.URL{Scheme: "https", Host: "www.windy.com", Path: "/test/meteogram", RawQuery: "49"}}
 
-	assert.Equal(t, "/a/www.windy.com/test/meteogram/manifest.json?49", u.manifestPath())
-	assert.Equal(t, "/a/www.windy.com/test/meteogram/service-worker.js?49", u.serviceWorkerPath())
-	assert.Equal(t, "/a/www.windy.com/test/meteogram/redirect.html?49", u.redirectPagePath())
+	assert.Equal(t, "/a/www.windy.com/test/meteogram/-/manifest.json?49", u.manifestPath())
+	assert.Equal(t, "/a/www.windy.com/test/meteogram/-/service-worker.js?49", u.serviceWorkerPath())
+	assert.Equal(t, "/a/www.windy.com/test/meteogram/-/redirect.html?49", u.redirectPagePath())
+}
+
+func TestAppURLPathsIncludeHTTPScheme(t *testing.T) {
+	u := &appURL{URL: url.URL{Scheme: "http", Host: "intranet.local:8080", Path: "/app/"}}
+
+	assert.Equal(t, "/a/http/intranet.local:8080/app/-/manifest.json", u.manifestPath())
+
+	// the path parses back into the same app
+	parsed, err := parseAppURL(&url.URL{Path: u.manifestPath()})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://intranet.local:8080/app", parsed.String())
+	}
+}
+
+func TestAppURLPathsEscapeDashSegments(t *testing.T) {
+	u := &appURL{URL: url.URL{Scheme: "https", Host: "example.com", Path: "/-/app/--"}}
+
+	assert.Equal(t, "/a/example.com/--/app/---/-/manifest.json", u.manifestPath())
+
+	parsed, err := parseAppURL(&url.URL{Path: u.manifestPath()})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/-/app/--", parsed.String())
+		assert.Equal(t, manifestPath, parsed.resource)
+	}
+}
+
+func TestAppURLPagePathMarksFileNames(t *testing.T) {
+	u := &appURL{URL: url.URL{Scheme: "https", Host: "example.com", Path: "/api/manifest.json", RawQuery: "a=1"}}
+
+	assert.Equal(t, "/a/example.com/api/manifest.json/-/?a=1", u.pagePath())
+
+	parsed, err := parseAppURL(&url.URL{Path: "/a/example.com/api/manifest.json/-/", RawQuery: "a=1"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/api/manifest.json?a=1", parsed.String())
+		assert.Empty(t, parsed.resource)
+	}
 }
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLength = 100
+	// maxShortNameOverrideLength is looser than MaxShortNameLength, the user chooses the name knowing
+	// launchers may truncate it, the limit only keeps the stored settings small
+	maxShortNameOverrideLength = 45
+	maxStartPathLength         = 2048
+)
+
+// Displays are the display modes a user can choose for the app
+var Displays = []string{"standalone", "fullscreen", "minimal-ui", "browser"}
+
+// Orientations are the values of the manifest's orientation member
+var Orientations = []string{
+	"any", "natural",
+	"landscape", "landscape-primary", "landscape-secondary",
+	"portrait", "portrait-primary", "portrait-secondary",
+}
+
+const (
+	StrategyNetworkFirst         = "network-first"
+	StrategyCacheFirst           = "cache-first"
+	StrategyStaleWhileRevalidate = "stale-while-revalidate"
+)
+
+// CacheStrategies are how the app's service worker answers requests, the first one is the default
+var CacheStrategies = []string{StrategyNetworkFirst, StrategyCacheFirst, StrategyStaleWhileRevalidate}
+
+// AppSettings are the manifest values chosen by the user when creating the app, empty values are not overridden
+type AppSettings struct {
+	Name            string
+	ShortName       string
+	Display         string
+	Orientation     string
+	ThemeColor      string
+	BackgroundColor string
+	// StartPath is the path with an optional query of the page the app opens on, e.g. "/inbox?tab=1"
+	StartPath string
+	// CacheStrategy is one of CacheStrategies, it isn't a manifest member, but belongs to the app's service worker
+	CacheStrategy string
+}
+
+// ParseAppSettings reads the settings from form fields named after the manifest members
+func ParseAppSettings(form url.Values) (settings AppSettings, err error) {
+	settings = AppSettings{
+		Name:            cleanName(form.Get("name")),
+		ShortName:       cleanName(form.Get("short_name")),
+		Display:         strings.TrimSpace(form.Get("display")),
+		Orientation:     strings.TrimSpace(form.Get("orientation")),
+		ThemeColor:      strings.TrimSpace(form.Get("theme_color")),
+		BackgroundColor: strings.TrimSpace(form.Get("background_color")),
+		StartPath:       strings.TrimSpace(form.Get("start_url")),
+		CacheStrategy:   strings.TrimSpace(form.Get("cache_strategy")),
+	}
+
+	return settings, settings.Validate()
+}
+
+// IsZero reports whether the settings override nothing
+func (s AppSettings) IsZero() bool {
+	return s == AppSettings{}
+}
+
+func (s AppSettings) Validate() error {
+	if utf8.RuneCountInString(s.Name) > maxNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+	if utf8.RuneCountInString(s.ShortName) > maxShortNameOverrideLength {
+		return fmt.Errorf("short_name is longer than %d characters", maxShortNameOverrideLength)
+	}
+	if s.Display != "" && !slices.Contains(Displays, s.Display) {
+		return fmt.Errorf("unsupported display: %q", s.Display)
+	}
+	if s.Orientation != "" && !slices.Contains(Orientations, s.Orientation) {
+		return fmt.Errorf("unsupported orientation: %q", s.Orientation)
+	}
+	if s.ThemeColor != "" && !ValidColor(s.ThemeColor) {
+		return fmt.Errorf("invalid theme_color: %q", s.ThemeColor)
+	}
+	if s.BackgroundColor != "" && !ValidColor(s.BackgroundColor) {
+		return fmt.Errorf("invalid background_color: %q", s.BackgroundColor)
+	}
+	if s.CacheStrategy != "" && !slices.Contains(CacheStrategies, s.CacheStrategy) {
+		return fmt.Errorf("unsupported cache_strategy: %q", s.CacheStrategy)
+	}
+	if s.StartPath != "" {
+		if _, err := s.StartURL(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Strategy returns the service worker's cache strategy, network-first unless chosen otherwise
+func (s AppSettings) Strategy() string {
+	if s.CacheStrategy == "" {
+		return CacheStrategies[0]
+	}
+	return s.CacheStrategy
+}
+
+// StartURL parses StartPath, only paths on the app's own site are allowed
+func (s AppSettings) StartURL() (*url.URL, error) {
+	if len(s.StartPath) > maxStartPathLength {
+		return nil, fmt.Errorf("start_url is longer than %d characters", maxStartPathLength)
+	}
+	if !strings.HasPrefix(s.StartPath, "/") || strings.HasPrefix(s.StartPath, "//") {
+		return nil, fmt.Errorf("start_url must be a path starting with a slash: %q", s.StartPath)
+	}
+
+	u, err := url.Parse(s.StartPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_url: %w", err)
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return nil, fmt.Errorf("start_url must be a path: %q", s.StartPath)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAppSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     url.Values
+		expected AppSettings
+		wantErr  bool
+	}{
+		{
+			name:     "no overrides",
+			form:     url.Values{"icons[]": {"https://example.com/icon.png"}},
+			expected: AppSettings{},
+		},
+		{
+			name: "all overrides",
+			form: url.Values{
+				"name":             {"  My   Mail "},
+				"short_name":       {"Mail"},
+				"display":          {"browser"},
+				"orientation":      {"portrait"},
+				"theme_color":      {"#112233"},
+				"background_color": {"white"},
+				"start_url":        {"/inbox?tab=1"},
+				"cache_strategy":   {"stale-while-revalidate"},
+			},
+			expected: AppSettings{
+				Name:            "My Mail",
+				ShortName:       "Mail",
+				Display:         "browser",
+				Orientation:     "portrait",
+				ThemeColor:      "#112233",
+				BackgroundColor: "white",
+				StartPath:       "/inbox?tab=1",
+				CacheStrategy:   StrategyStaleWhileRevalidate,
+			},
+		},
+		{
+			// the user's short name may be longer than the scraped ones, launchers truncate it
+			name:     "short name longer than launchers display",
+			form:     url.Values{"short_name": {strings.Repeat("m", 45)}},
+			expected: AppSettings{ShortName: strings.Repeat("m", 45)},
+		},
+		{
+			name:    "too long short name",
+			form:    url.Values{"short_name": {strings.Repeat("m", 46)}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown display",
+			form:    url.Values{"display": {"window"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown orientation",
+			form:    url.Values{"orientation": {"sideways"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown cache strategy",
+			form:    url.Values{"cache_strategy": {"cache-only"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid color",
+			form:    url.Values{"theme_color": {`red"><script>`}},
+			wantErr: true,
+		},
+		{
+			name:    "start url on another site",
+			form:    url.Values{"start_url": {"//evil.example.com/"}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute start url",
+			form:    url.Values{"start_url": {"https://evil.example.com/"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := ParseAppSettings(tt.form)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, settings)
+		})
+	}
+}
@@ -1,66 +1,104 @@
 package icons
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/nazar256/intopwa/internal/domain"
+	"io"
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 )
 
+const blobPrefix = "icons/"
+
 //go:generate go run github.com/vektra/mockery/v2@v2.43.2 --dir=. --name kv --output ./mocks --outpkg mocks --case underscore  --with-expecter --exported
 type kv interface {
 	Get(key string) ([]byte, error)
 	Put(key string, value []byte) error
 }
 
+// blobs stores icon bodies, Get returns a nil reader for missing paths
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.43.2 --dir=. --name blobs --output ./mocks --outpkg mocks --case underscore  --with-expecter --exported
+type blobs interface {
+	Get(path string) (io.Reader, error)
+	Put(path string, data io.Reader) error
+}
+
+// iconRecord is an entry of the per-host icons index kept in KV.
+// The icon body lives in the blob store under the SHA-256 of its content.
+type iconRecord struct {
+	URL   *url.URL
+	Body  []byte `json:",omitempty"` // legacy records kept the body inline
+	Props domain.ImageProps
+	Blob  string `json:",omitempty"`
+	// FetchedAt is a unix timestamp of the download, legacy records have none
+	FetchedAt int64 `json:",omitempty"`
+}
+
 type cache struct {
 	icons kv
+	blobs blobs
 }
 
-func NewCache(icons kv) *cache {
+func NewCache(icons kv, blobs blobs) *cache {
 	return &cache{
 		icons: icons,
+		blobs: blobs,
 	}
 }
 
+// Get returns cached icons with their bodies, only the blobs of the requested icons are read
 func (c *cache) Get(urls []*url.URL) (icons []domain.Icon, found bool, err error) {
-	// group icons by domain, domain is a key
-	batches := make(map[string]struct{}, len(urls))
-	for _, u := range urls {
-		batches[u.Hostname()] = struct{}{}
+	records, found, err := c.records(urls)
+	if err != nil {
+		return icons, found, err
 	}
 
-	var foundIcons []domain.Icon
-
-	for host := range batches {
-		iconsJSON, err := c.icons.Get(host)
-		if err != nil {
-			return icons, found, fmt.Errorf("failed to read from KV (key: %s): %w", host, err)
+	for _, r := range records {
+		body := r.Body
+		if r.Blob != "" {
+			body, err = c.readBlob(r.Blob)
+			if err != nil {
+				return icons, found, err
+			}
+			if body == nil {
+				// the blob is gone, so the icon has to be downloaded again
+				return nil, false, nil
+			}
 		}
 
-		if iconsJSON == nil {
-			continue
-		}
+		icons = append(icons, domain.Icon{
+			URL:       r.URL,
+			Body:      body,
+			Props:     r.Props,
+			FetchedAt: r.fetchedAt(),
+			Hash:      r.Blob,
+		})
+	}
 
-		var iconsBatch []domain.Icon
-		err = json.Unmarshal(iconsJSON, &iconsBatch)
-		if err != nil {
-			return icons, found, fmt.Errorf("failed to decode icons (%s): %w", host, err)
-		}
-		found = true
+	return icons, found, nil
+}
 
-		foundIcons = append(foundIcons, iconsBatch...)
+// GetMeta returns cached icons without reading their bodies
+func (c *cache) GetMeta(urls []*url.URL) (icons []domain.Icon, found bool, err error) {
+	records, found, err := c.records(urls)
+	if err != nil {
+		return icons, found, err
 	}
 
-	for _, i := range foundIcons {
-		for _, u := range urls {
-			if i.URL.String() == u.String() {
-				icons = append(icons, i)
-				break
-			}
-		}
+	for _, r := range records {
+		icons = append(icons, domain.Icon{
+			URL:       r.URL,
+			Props:     r.Props,
+			FetchedAt: r.fetchedAt(),
+			Hash:      r.Blob,
+		})
 	}
 
 	return icons, found, nil
@@ -68,38 +106,45 @@ func (c *cache) Get(urls []*url.URL) (icons []domain.Icon, found bool, err error
 
 func (c *cache) Store(icons []domain.Icon) (err error) {
 	// group icons by domain, domain is a key
-	batches := make(map[string][]domain.Icon, 1)
+	batches := make(map[string][]iconRecord, 1)
 	for _, icon := range icons {
+		blob, err := c.writeBlob(icon.Body)
+		if err != nil {
+			return err
+		}
+
+		fetchedAt := icon.FetchedAt
+		if fetchedAt.IsZero() {
+			fetchedAt = time.Now()
+		}
+
 		host := icon.URL.Hostname()
-		batches[host] = append(batches[host], icon)
+		batches[host] = append(batches[host], iconRecord{
+			URL:       icon.URL,
+			Props:     icon.Props,
+			Blob:      blob,
+			FetchedAt: fetchedAt.Unix(),
+		})
 	}
 
-	for host, iconsBatch := range batches {
-		batchUrls := make([]*url.URL, 0, len(iconsBatch))
-		for _, i := range iconsBatch {
-			batchUrls = append(batchUrls, i.URL)
-		}
-		existingIcons, _, err := c.Get(batchUrls)
+	for host, batch := range batches {
+		existing, err := c.index(host)
 		if err != nil {
-			return fmt.Errorf("failed to read icons cache before merge: %w", err)
+			return fmt.Errorf("failed to read icons index before merge: %w", err)
 		}
 
-		existingIcons = append(existingIcons, iconsBatch...)
-
-		slices.SortFunc(existingIcons, func(a, b domain.Icon) int {
+		// new records go first, so they win over the existing ones with the same URL
+		merged := append(batch, existing...)
+		slices.SortStableFunc(merged, func(a, b iconRecord) int {
 			return strings.Compare(a.URL.String(), b.URL.String())
 		})
-		existingIcons = slices.CompactFunc(existingIcons, func(a, b domain.Icon) bool {
+		merged = slices.CompactFunc(merged, func(a, b iconRecord) bool {
 			return a.URL.String() == b.URL.String()
 		})
 
-		batches[host] = existingIcons
-	}
-
-	for host, batch := range batches {
-		jsonValue, err := json.Marshal(batch)
+		jsonValue, err := json.Marshal(merged)
 		if err != nil {
-			return fmt.Errorf("failed to encode icons batch: %w", err)
+			return fmt.Errorf("failed to encode icons index: %w", err)
 		}
 
 		err = c.icons.Put(host, jsonValue)
@@ -110,3 +155,100 @@ func (c *cache) Store(icons []domain.Icon) (err error) {
 
 	return nil
 }
+
+// records returns index records of the requested URLs, found reports whether any host index exists
+func (c *cache) records(urls []*url.URL) (records []iconRecord, found bool, err error) {
+	// group icons by domain, domain is a key
+	batches := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		batches[u.Hostname()] = struct{}{}
+	}
+
+	var foundRecords []iconRecord
+
+	for host := range batches {
+		index, err := c.index(host)
+		if err != nil {
+			return records, found, err
+		}
+
+		if index == nil {
+			continue
+		}
+		found = true
+
+		foundRecords = append(foundRecords, index...)
+	}
+
+	for _, r := range foundRecords {
+		for _, u := range urls {
+			if r.URL.String() == u.String() {
+				records = append(records, r)
+				break
+			}
+		}
+	}
+
+	return records, found, nil
+}
+
+func (r iconRecord) fetchedAt() time.Time {
+	if r.FetchedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(r.FetchedAt, 0)
+}
+
+func (c *cache) index(host string) ([]iconRecord, error) {
+	indexJSON, err := c.icons.Get(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from KV (key: %s): %w", host, err)
+	}
+
+	if indexJSON == nil {
+		return nil, nil
+	}
+
+	var index []iconRecord
+	err = json.Unmarshal(indexJSON, &index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode icons (%s): %w", host, err)
+	}
+
+	return index, nil
+}
+
+func (c *cache) readBlob(hash string) ([]byte, error) {
+	reader, err := c.blobs.Get(blobPrefix + hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read icon blob (%s): %w", hash, err)
+	}
+
+	if reader == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read icon blob (%s): %w", hash, err)
+	}
+
+	return body, nil
+}
+
+// writeBlob stores the body under its SHA-256, identical icons from different URLs share one blob
+func (c *cache) writeBlob(body []byte) (hash string, err error) {
+	if len(body) == 0 {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(body)
+	hash = hex.EncodeToString(sum[:])
+
+	err = c.blobs.Put(blobPrefix+hash, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to write icon blob (%s): %w", hash, err)
+	}
+
+	return hash, nil
+}
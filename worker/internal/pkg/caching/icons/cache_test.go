@@ -6,8 +6,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -16,6 +19,21 @@ const (
 			[{"URL":{"Scheme":"https","Opaque":"","User":null,"Host":"google.com",
 			"Path":"/static/favicon.ico","RawPath":"","OmitHost":false,"ForceQuery":false,"RawQuery":"","Fragment":"",
 			"RawFragment":""},"Body":"YQ==","Props":{"MimeType":"image/x-icon","Size":{"Width":64,"Height":64}}}]
+`
+	// sha256 of "a"
+	googleFaviconBlobHash   = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+	googleFaviconBlobRecord = `
+			[{"URL":{"Scheme":"https","Opaque":"","User":null,"Host":"google.com",
+			"Path":"/static/favicon.ico","RawPath":"","OmitHost":false,"ForceQuery":false,"RawQuery":"","Fragment":"",
+			"RawFragment":""},"Props":{"MimeType":"image/x-icon","Size":{"Width":64,"Height":64}},
+			"Blob":"` + googleFaviconBlobHash + `"}]
+`
+	googleFaviconFetchedAt    = 1700000000
+	googleFaviconStoredRecord = `
+			[{"URL":{"Scheme":"https","Opaque":"","User":null,"Host":"google.com",
+			"Path":"/static/favicon.ico","RawPath":"","OmitHost":false,"ForceQuery":false,"RawQuery":"","Fragment":"",
+			"RawFragment":""},"Props":{"MimeType":"image/x-icon","Size":{"Width":64,"Height":64}},
+			"Blob":"` + googleFaviconBlobHash + `","FetchedAt":1700000000}]
 `
 )
 
@@ -26,6 +44,7 @@ func TestCache_Get(t *testing.T) {
 		name          string
 		urls          []string
 		kv            map[string]string
+		blobs         map[string]string
 		expectedIcons []domain.Icon
 	}{
 		{
@@ -40,8 +59,29 @@ func TestCache_Get(t *testing.T) {
 					Body: []byte("a"),
 					Props: domain.ImageProps{
 						MimeType: "image/x-icon",
-						Size:     domain.ImageSize{64, 64},
+						Size:     domain.ImageSize{Width: 64, Height: 64},
+					},
+				},
+			},
+		},
+		{
+			name: "favicon in blob storage",
+			urls: []string{"https://google.com/static/favicon.ico"},
+			kv: map[string]string{
+				"google.com": googleFaviconBlobRecord,
+			},
+			blobs: map[string]string{
+				"icons/" + googleFaviconBlobHash: "a",
+			},
+			expectedIcons: []domain.Icon{
+				{
+					URL:  googleFaviconUrl,
+					Body: []byte("a"),
+					Props: domain.ImageProps{
+						MimeType: "image/x-icon",
+						Size:     domain.ImageSize{Width: 64, Height: 64},
 					},
+					Hash: googleFaviconBlobHash,
 				},
 			},
 		},
@@ -63,8 +103,15 @@ func TestCache_Get(t *testing.T) {
 					Once()
 			}
 
+			blobsMock := mocks.NewBlobs(t)
+			for path, val := range tc.blobs {
+				blobsMock.EXPECT().Get(path).
+					Return(strings.NewReader(val), nil).
+					Once()
+			}
+
 			// Initialize your cache here
-			c := NewCache(kvMock)
+			c := NewCache(kvMock, blobsMock)
 
 			icons, found, err := c.Get(urls)
 			assert.NoError(t, err)
@@ -81,14 +128,14 @@ func TestCache_Store(t *testing.T) {
 		name            string
 		url             string
 		icons           []domain.Icon
-		initMocks       func(kv *mocks.Kv)
+		initMocks       func(kv *mocks.Kv, blobs *mocks.Blobs)
 		expectedKvValue string
 	}{
 		{
 			name:  "empty list NOP",
 			url:   googleFaviconUrlString,
 			icons: []domain.Icon{},
-			initMocks: func(kv *mocks.Kv) {
+			initMocks: func(kv *mocks.Kv, blobs *mocks.Blobs) {
 
 			},
 		},
@@ -101,15 +148,45 @@ func TestCache_Store(t *testing.T) {
 					Body: []byte("a"),
 					Props: domain.ImageProps{
 						MimeType: "image/x-icon",
-						Size:     domain.ImageSize{64, 64},
+						Size:     domain.ImageSize{Width: 64, Height: 64},
 					},
+					FetchedAt: time.Unix(googleFaviconFetchedAt, 0),
 				},
 			},
-			initMocks: func(kv *mocks.Kv) {
+			initMocks: func(kv *mocks.Kv, blobs *mocks.Blobs) {
+				blobs.EXPECT().Put("icons/"+googleFaviconBlobHash, mock.MatchedBy(func(r io.Reader) bool {
+					body, err := io.ReadAll(r)
+					return err == nil && string(body) == "a"
+				})).Return(nil).Once()
 				kv.EXPECT().Get("google.com").
 					Return(nil, nil).Once()
 				kv.EXPECT().Put("google.com", mock.MatchedBy(func(b []byte) bool {
-					return assert.JSONEq(t, googleFaviconOnlyRecord, string(b))
+					return assert.JSONEq(t, googleFaviconStoredRecord, string(b))
+				})).Return(nil).Once()
+			},
+		},
+		{
+			name: "existing icons of the host are kept",
+			url:  googleFaviconUrlString,
+			icons: []domain.Icon{
+				{
+					URL:  googleFaviconUrl,
+					Body: []byte("a"),
+					Props: domain.ImageProps{
+						MimeType: "image/x-icon",
+						Size:     domain.ImageSize{Width: 64, Height: 64},
+					},
+				},
+			},
+			initMocks: func(kv *mocks.Kv, blobs *mocks.Blobs) {
+				blobs.EXPECT().Put("icons/"+googleFaviconBlobHash, mock.Anything).
+					Return(nil).Once()
+				kv.EXPECT().Get("google.com").
+					Return([]byte(`[{"URL":{"Scheme":"https","Host":"google.com","Path":"/logo.svg"},
+					"Props":{"MimeType":"image/svg+xml","Size":{"Width":24,"Height":24}},"Blob":"b"}]`), nil).Once()
+				kv.EXPECT().Put("google.com", mock.MatchedBy(func(b []byte) bool {
+					return strings.Contains(string(b), `"Path":"/logo.svg"`) &&
+						strings.Contains(string(b), `"Blob":"`+googleFaviconBlobHash+`"`)
 				})).Return(nil).Once()
 			},
 		},
@@ -118,16 +195,17 @@ func TestCache_Store(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			kvMock := mocks.NewKv(t)
+			blobsMock := mocks.NewBlobs(t)
 			defer func() {
 				kvMock.ExpectedCalls = nil
 			}()
 
 			if tc.initMocks != nil {
-				tc.initMocks(kvMock)
+				tc.initMocks(kvMock, blobsMock)
 			}
 
 			// Initialize your cache here
-			c := NewCache(kvMock)
+			c := NewCache(kvMock, blobsMock)
 
 			err := c.Store(tc.icons)
 			assert.NoError(t, err)
@@ -1,10 +1,13 @@
 package links
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
 	"net/url"
 	"strings"
+	"time"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.43.2 --dir=. --name kv --output ./mocks --outpkg mocks --case underscore  --with-expecter --exported
@@ -13,97 +16,422 @@ type kv interface {
 	Put(key string, value []byte) error
 }
 
+// failuresKV keeps scrape failures, entries expire after about the failure TTL of the fetcher
+type failuresKV interface {
+	kv
+	Delete(key string) error
+}
+
+// pageRecord is a scraped page stored in KV.
+// Older records are plain JSON lists of icon URLs or keep the URLs in Icons without link attributes.
+type pageRecord struct {
+	Icons        []string         `json:"icons,omitempty"`
+	IconLinks    []iconLinkRecord `json:"icon_links,omitempty"`
+	Manifest     *manifestRecord  `json:"manifest,omitempty"`
+	Metadata     *metadataRecord  `json:"metadata,omitempty"`
+	URL          string           `json:"url,omitempty"`
+	CanonicalURL string           `json:"canonical_url,omitempty"`
+	// FetchedAt is a unix timestamp of the scrape, legacy records have none
+	FetchedAt int64 `json:"fetched_at,omitempty"`
+}
+
+type metadataRecord struct {
+	Title           string `json:"title,omitempty"`
+	SiteName        string `json:"site_name,omitempty"`
+	ApplicationName string `json:"application_name,omitempty"`
+	AppleTitle      string `json:"apple_title,omitempty"`
+	Description     string `json:"description,omitempty"`
+	ThemeColor      string `json:"theme_color,omitempty"`
+	ThemeColorDark  string `json:"theme_color_dark,omitempty"`
+}
+
+type manifestRecord struct {
+	Name            string           `json:"name,omitempty"`
+	ShortName       string           `json:"short_name,omitempty"`
+	ThemeColor      string           `json:"theme_color,omitempty"`
+	BackgroundColor string           `json:"background_color,omitempty"`
+	Display         string           `json:"display,omitempty"`
+	Icons           []iconLinkRecord `json:"icons,omitempty"`
+}
+
+type iconLinkRecord struct {
+	URL     string `json:"url"`
+	Sizes   string `json:"sizes,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+	Rel     string `json:"rel,omitempty"`
+	Media   string `json:"media,omitempty"`
+}
+
+// failureRecord is the reason the page couldn't be scraped
+type failureRecord struct {
+	Reason      string `json:"reason"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Message     string `json:"message,omitempty"`
+	// FailedAt is a unix timestamp, the failure is ignored once it's older than the fetcher's TTL
+	FailedAt int64 `json:"failed_at"`
+}
+
+const (
+	// aliasKeyPrefix separates aliases from pages sharing the namespace
+	aliasKeyPrefix = "alias:"
+	// failureKeyPrefix separates scrape failures from pages when both share the namespace
+	failureKeyPrefix = "failure:"
+)
+
 type cache struct {
-	kv kv
+	kv       kv
+	failures failuresKV
 }
 
-func NewCache(kv kv) *cache {
+// NewCache stores pages and aliases in kv, failures are kept apart since they expire much sooner
+func NewCache(kv kv, failures failuresKV) *cache {
 	return &cache{
-		kv: kv,
+		kv:       kv,
+		failures: failures,
 	}
 }
 
-func (c *cache) GetIconURLs(u *url.URL) (urls []*url.URL, found bool, err error) {
+func (c *cache) GetPage(u *url.URL) (page domain.Page, found bool, err error) {
 	key := keyFromURl(u)
 
-	linksJSON, err := c.kv.Get(key)
+	pageJSON, err := c.kv.Get(key)
 	if err != nil {
-		return urls, found, fmt.Errorf("failed to read from KV (key: %s): %w", key, err)
+		return page, found, fmt.Errorf("failed to read from KV (key: %s): %w", key, err)
 	}
 
-	if linksJSON == nil {
-		return urls, false, nil
+	if pageJSON == nil {
+		return page, false, nil
 	}
 
-	var urlStrs []string
-	err = json.Unmarshal(linksJSON, &urlStrs)
+	var record pageRecord
+	if bytes.HasPrefix(bytes.TrimSpace(pageJSON), []byte("[")) {
+		err = json.Unmarshal(pageJSON, &record.Icons)
+	} else {
+		err = json.Unmarshal(pageJSON, &record)
+	}
 	if err != nil {
-		return urls, found, fmt.Errorf("failed to decode kv (key:%s): %w", key, err)
+		return page, found, fmt.Errorf("failed to decode kv (key:%s): %w", key, err)
 	}
 
-	for _, urlStr := range urlStrs {
-		iconURL, err := url.Parse(urlStr)
-		if err != nil {
-			return urls, found, fmt.Errorf("failed to parse icon URL (%s): %w", urlStr, err)
+	page, err = record.page()
+	if err != nil {
+		return page, found, fmt.Errorf("failed to decode kv (key:%s): %w", key, err)
+	}
+
+	return page, true, nil
+}
+
+func (c *cache) StorePage(u *url.URL, page domain.Page) error {
+	record := pageRecord{
+		IconLinks:    linkRecords(page.IconLinks),
+		URL:          urlString(page.URL),
+		CanonicalURL: urlString(page.CanonicalURL),
+		FetchedAt:    page.FetchedAt.Unix(),
+	}
+	if page.FetchedAt.IsZero() {
+		record.FetchedAt = time.Now().Unix()
+	}
+
+	if page.Metadata != (domain.PageMetadata{}) {
+		record.Metadata = &metadataRecord{
+			Title:           page.Metadata.Title,
+			SiteName:        page.Metadata.SiteName,
+			ApplicationName: page.Metadata.ApplicationName,
+			AppleTitle:      page.Metadata.AppleTitle,
+			Description:     page.Metadata.Description,
+			ThemeColor:      page.Metadata.ThemeColor,
+			ThemeColorDark:  page.Metadata.ThemeColorDark,
 		}
-		urls = append(urls, iconURL)
 	}
 
-	return urls, true, nil
+	if page.Manifest != nil {
+		record.Manifest = &manifestRecord{
+			Name:            page.Manifest.Name,
+			ShortName:       page.Manifest.ShortName,
+			ThemeColor:      page.Manifest.ThemeColor,
+			BackgroundColor: page.Manifest.BackgroundColor,
+			Display:         page.Manifest.Display,
+			Icons:           linkRecords(page.Manifest.Icons),
+		}
+	}
+
+	jsonValue, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode kv batch: %w", err)
+	}
+
+	err = c.kv.Put(keyFromURl(u), jsonValue)
+	if err != nil {
+		return fmt.Errorf("failed to write to KV (key:%s): %w", keyFromURl(u), err)
+	}
+
+	return nil
+}
+
+// GetAlias returns the identity of the app the URL is an alias of
+func (c *cache) GetAlias(u *url.URL) (identity *url.URL, found bool, err error) {
+	key := aliasKeyPrefix + keyFromURl(u)
+
+	value, err := c.kv.Get(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read from KV (key: %s): %w", key, err)
+	}
+
+	if value == nil {
+		return nil, false, nil
+	}
+
+	identity, err = url.Parse(string(value))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse app identity (key: %s): %w", key, err)
+	}
+
+	return identity, true, nil
+}
+
+// StoreAlias makes the URL share the cached page of the app identified by identity
+func (c *cache) StoreAlias(u *url.URL, identity *url.URL) error {
+	key := aliasKeyPrefix + keyFromURl(u)
+
+	err := c.kv.Put(key, []byte(identity.String()))
+	if err != nil {
+		return fmt.Errorf("failed to write to KV (key:%s): %w", key, err)
+	}
+
+	return nil
+}
+
+// GetFailure returns the last failure of scraping the page, a cleared failure isn't found
+func (c *cache) GetFailure(u *url.URL) (failure domain.ScrapeFailure, found bool, err error) {
+	key := failureKeyPrefix + keyFromURl(u)
+
+	value, err := c.failures.Get(key)
+	if err != nil {
+		return failure, false, fmt.Errorf("failed to read from KV (key: %s): %w", key, err)
+	}
+
+	if len(value) == 0 {
+		return failure, false, nil
+	}
+
+	var record failureRecord
+	err = json.Unmarshal(value, &record)
+	if err != nil {
+		return failure, false, fmt.Errorf("failed to decode kv (key:%s): %w", key, err)
+	}
+
+	return domain.ScrapeFailure{
+		Reason:      record.Reason,
+		Status:      record.Status,
+		ContentType: record.ContentType,
+		Message:     record.Message,
+		FailedAt:    time.Unix(record.FailedAt, 0),
+	}, true, nil
+}
+
+// StoreFailure remembers why scraping the page failed
+func (c *cache) StoreFailure(u *url.URL, failure domain.ScrapeFailure) error {
+	record := failureRecord{
+		Reason:      failure.Reason,
+		Status:      failure.Status,
+		ContentType: failure.ContentType,
+		Message:     failure.Message,
+		FailedAt:    failure.FailedAt.Unix(),
+	}
+	if failure.FailedAt.IsZero() {
+		record.FailedAt = time.Now().Unix()
+	}
+
+	jsonValue, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode failure: %w", err)
+	}
+
+	key := failureKeyPrefix + keyFromURl(u)
+
+	err = c.failures.Put(key, jsonValue)
+	if err != nil {
+		return fmt.Errorf("failed to write to KV (key:%s): %w", key, err)
+	}
+
+	return nil
+}
+
+// ClearFailure forgets the failure, so the page is scraped on the next request
+func (c *cache) ClearFailure(u *url.URL) error {
+	key := failureKeyPrefix + keyFromURl(u)
+
+	err := c.failures.Delete(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete from KV (key:%s): %w", key, err)
+	}
+
+	return nil
+}
+
+func (c *cache) GetIconURLs(u *url.URL) (urls []*url.URL, found bool, err error) {
+	page, found, err := c.GetPage(u)
+	return domain.IconURLs(page.IconLinks), found, err
 }
 
+// StoreIconURLs replaces the icon links of the page with the user's icons keeping the rest of the scraped data,
+// an empty list keeps the existing icons
 func (c *cache) StoreIconURLs(u *url.URL, iconsURLs []*url.URL) error {
-	var (
-		urls []*url.URL
-		err  error
-	)
+	page, _, err := c.GetPage(u)
+	if err != nil {
+		return fmt.Errorf("failed to read icons list before merge: %w", err)
+	}
 
-	if len(iconsURLs) == 0 {
-		urls, _, err = c.GetIconURLs(u)
-		if err != nil {
-			return fmt.Errorf("failed to read icons list before merge: %w", err)
+	if len(iconsURLs) > 0 {
+		page.IconLinks = make([]domain.IconLink, 0, len(iconsURLs))
+		for _, iconURL := range iconsURLs {
+			page.IconLinks = append(page.IconLinks, domain.IconLink{URL: iconURL, Rel: domain.RelCustom})
 		}
-	} else {
-		urls = iconsURLs
 	}
 
-	filtered := make([]*url.URL, 0, len(urls))
-	seen := make(map[string]struct{}, len(urls))
+	return c.StorePage(u, page)
+}
 
-	for _, iu := range urls {
-		if iu == nil {
-			continue
-		}
+func (r pageRecord) page() (page domain.Page, err error) {
+	page.IconLinks, err = parseLinks(r.IconLinks)
+	if err != nil {
+		return page, err
+	}
 
-		urlStr := iu.String()
-		if _, ok := seen[urlStr]; ok {
-			continue
-		}
+	page.URL, err = parseOptionalURL(r.URL)
+	if err != nil {
+		return page, err
+	}
+	page.CanonicalURL, err = parseOptionalURL(r.CanonicalURL)
+	if err != nil {
+		return page, err
+	}
 
-		filtered = append(filtered, iu)
-		seen[urlStr] = struct{}{}
+	if r.FetchedAt != 0 {
+		page.FetchedAt = time.Unix(r.FetchedAt, 0)
 	}
 
-	urlStrs := make([]string, 0, len(filtered))
-	for _, iu := range filtered {
-		urlStrs = append(urlStrs, iu.String())
+	// legacy lists were downloaded in full, so they stay custom to be never ranked out
+	legacyURLs, err := parseURLs(r.Icons)
+	if err != nil {
+		return page, err
+	}
+	for _, iconURL := range legacyURLs {
+		page.IconLinks = append(page.IconLinks, domain.IconLink{URL: iconURL, Rel: domain.RelCustom})
+	}
+
+	if r.Metadata != nil {
+		page.Metadata = domain.PageMetadata{
+			Title:           r.Metadata.Title,
+			SiteName:        r.Metadata.SiteName,
+			ApplicationName: r.Metadata.ApplicationName,
+			AppleTitle:      r.Metadata.AppleTitle,
+			Description:     r.Metadata.Description,
+			ThemeColor:      r.Metadata.ThemeColor,
+			ThemeColorDark:  r.Metadata.ThemeColorDark,
+		}
 	}
 
-	jsonValue, err := json.Marshal(urlStrs)
+	if r.Manifest == nil {
+		return page, nil
+	}
+
+	page.Manifest = &domain.WebManifest{
+		Name:            r.Manifest.Name,
+		ShortName:       r.Manifest.ShortName,
+		ThemeColor:      r.Manifest.ThemeColor,
+		BackgroundColor: r.Manifest.BackgroundColor,
+		Display:         r.Manifest.Display,
+	}
+	page.Manifest.Icons, err = parseLinks(r.Manifest.Icons)
 	if err != nil {
-		return fmt.Errorf("failed to encode kv batch: %w", err)
+		return page, err
 	}
 
-	err = c.kv.Put(keyFromURl(u), jsonValue)
+	return page, nil
+}
+
+func parseLinks(records []iconLinkRecord) (links []domain.IconLink, err error) {
+	for _, record := range records {
+		iconURL, err := url.Parse(record.URL)
+		if err != nil {
+			return links, fmt.Errorf("failed to parse icon URL (%s): %w", record.URL, err)
+		}
+		links = append(links, domain.IconLink{
+			URL:     iconURL,
+			Sizes:   record.Sizes,
+			Type:    record.Type,
+			Purpose: record.Purpose,
+			Rel:     record.Rel,
+			Media:   record.Media,
+		})
+	}
+	return links, nil
+}
+
+func parseOptionalURL(urlStr string) (*url.URL, error) {
+	if urlStr == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(urlStr)
 	if err != nil {
-		return fmt.Errorf("failed to write to KV (key:%s): %w", keyFromURl(u), err)
+		return nil, fmt.Errorf("failed to parse page URL (%s): %w", urlStr, err)
 	}
+	return u, nil
+}
 
-	return nil
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func parseURLs(urlStrs []string) (urls []*url.URL, err error) {
+	for _, urlStr := range urlStrs {
+		iconURL, err := url.Parse(urlStr)
+		if err != nil {
+			return urls, fmt.Errorf("failed to parse icon URL (%s): %w", urlStr, err)
+		}
+		urls = append(urls, iconURL)
+	}
+	return urls, nil
+}
+
+// linkRecords filters out links with nil and duplicated URLs
+func linkRecords(links []domain.IconLink) []iconLinkRecord {
+	records := make([]iconLinkRecord, 0, len(links))
+	seen := make(map[string]struct{}, len(links))
+
+	for _, link := range links {
+		if link.URL == nil {
+			continue
+		}
+
+		urlStr := link.URL.String()
+		if _, ok := seen[urlStr]; ok {
+			continue
+		}
+
+		records = append(records, iconLinkRecord{
+			URL:     urlStr,
+			Sizes:   link.Sizes,
+			Type:    link.Type,
+			Purpose: link.Purpose,
+			Rel:     link.Rel,
+			Media:   link.Media,
+		})
+		seen[urlStr] = struct{}{}
+	}
+
+	return records
 }
 
 func keyFromURl(u *url.URL) string {
-	key := u.Hostname() + strings.TrimSuffix(u.Path, "/")
+	// https keys have no scheme, so keys made before plain HTTP was supported stay valid, see domain.KeyHost
+	key := domain.SchemePathPrefix(u) + domain.KeyHost(u) + strings.TrimSuffix(u.Path, "/")
 	if u.RawQuery != "" {
 		key += "?" + u.RawQuery
 	}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/nazar256/intopwa/internal/domain"
 	"github.com/nazar256/intopwa/internal/pkg/caching/links/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +18,21 @@ func TestKeyFromURLIncludesQuery(t *testing.T) {
 	assert.NotEqual(t, keyFromURl(u1), keyFromURl(u2))
 }
 
+func TestKeyFromURLKeepsSchemeAndPort(t *testing.T) {
+	httpsURL, _ := url.Parse("https://example.com/app/")
+	httpURL, _ := url.Parse("http://example.com/app")
+	portURL, _ := url.Parse("https://example.com:8443/app")
+	defaultPortURL, _ := url.Parse("https://example.com:443/app")
+	httpDefaultPortURL, _ := url.Parse("http://example.com:80/app")
+
+	assert.Equal(t, "example.com/app", keyFromURl(httpsURL))
+	assert.Equal(t, "http/example.com/app", keyFromURl(httpURL))
+	assert.Equal(t, "example.com:8443/app", keyFromURl(portURL))
+	// default ports keep the keys made before ports were kept
+	assert.Equal(t, "example.com/app", keyFromURl(defaultPortURL))
+	assert.Equal(t, "http/example.com/app", keyFromURl(httpDefaultPortURL))
+}
+
 func TestGetIconURLsUsesQueryInKey(t *testing.T) {
 	u, _ := url.Parse("https://example.com/path?foo=bar")
 	key := "example.com/path?foo=bar"
@@ -23,7 +40,7 @@ func TestGetIconURLsUsesQueryInKey(t *testing.T) {
 	kv := mocks.NewKv(t)
 	kv.EXPECT().Get(key).Return([]byte(`["https://icon.com/favicon.ico"]`), nil).Once()
 
-	c := NewCache(kv)
+	c := NewCache(kv, newMemKV())
 	urls, found, err := c.GetIconURLs(u)
 	assert.NoError(t, err)
 	assert.True(t, found)
@@ -36,7 +53,7 @@ func TestStoreIconURLsFiltersNilAndDuplicates(t *testing.T) {
 	u, _ := url.Parse("https://chatgpt.com/")
 
 	kv := newMemKV()
-	cache := NewCache(kv)
+	cache := NewCache(kv, newMemKV())
 
 	icon1, _ := url.Parse("https://static.chatgpt.com/icon.png")
 	icon2, _ := url.Parse("https://static.chatgpt.com/icon.svg")
@@ -67,7 +84,7 @@ func TestStoreIconURLsReplacesExistingIcons(t *testing.T) {
 	err = kv.Put("chatgpt.com", existingJSON)
 	require.NoError(t, err)
 
-	cache := NewCache(kv)
+	cache := NewCache(kv, newMemKV())
 
 	customIcon, _ := url.Parse("https://static.chatgpt.com/custom.png")
 	err = cache.StoreIconURLs(u, []*url.URL{customIcon})
@@ -82,10 +99,113 @@ func TestStoreIconURLsReplacesExistingIcons(t *testing.T) {
 	}
 }
 
+func TestGetPageReadsLegacyIconsAsCustom(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+
+	kv := newMemKV()
+	err := kv.Put("example.com", []byte(`{"icons":["https://example.com/icon.png"]}`))
+	require.NoError(t, err)
+
+	page, found, err := NewCache(kv, newMemKV()).GetPage(u)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	if assert.Len(t, page.IconLinks, 1) {
+		assert.Equal(t, "https://example.com/icon.png", page.IconLinks[0].URL.String())
+		assert.Equal(t, domain.RelCustom, page.IconLinks[0].Rel)
+	}
+}
+
+func TestStorePageKeepsScrapedData(t *testing.T) {
+	u, _ := url.Parse("https://example.com/app")
+	favicon, _ := url.Parse("https://example.com/favicon.ico")
+	maskable, _ := url.Parse("https://example.com/icons/maskable.png")
+	custom, _ := url.Parse("https://cdn.example.com/custom.png")
+
+	page := domain.Page{
+		IconLinks: []domain.IconLink{
+			{URL: favicon, Rel: "icon", Sizes: "16x16 32x32", Type: "image/x-icon", Media: "(prefers-color-scheme: dark)"},
+		},
+		Metadata: domain.PageMetadata{
+			Title:       "Home - Example",
+			Description: "Example application",
+			ThemeColor:  "#ffffff",
+		},
+		Manifest: &domain.WebManifest{
+			Name:       "Example",
+			ShortName:  "Ex",
+			ThemeColor: "#112233",
+			Display:    "standalone",
+			Icons: []domain.IconLink{
+				{URL: maskable, Sizes: "512x512", Type: "image/png", Purpose: "maskable"},
+			},
+		},
+		FetchedAt: time.Unix(1700000000, 0),
+	}
+
+	cache := NewCache(newMemKV(), newMemKV())
+
+	err := cache.StorePage(u, page)
+	require.NoError(t, err)
+
+	cached, found, err := cache.GetPage(u)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, page, cached)
+
+	// custom icons replace the scraped ones, but the rest of the page stays
+	err = cache.StoreIconURLs(u, []*url.URL{custom})
+	require.NoError(t, err)
+
+	cached, found, err = cache.GetPage(u)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, []domain.IconLink{{URL: custom, Rel: domain.RelCustom}}, cached.IconLinks)
+	assert.Equal(t, page.Manifest, cached.Manifest)
+	assert.Equal(t, page.Metadata, cached.Metadata)
+	assert.Equal(t, page.FetchedAt, cached.FetchedAt)
+}
+
 type memKV struct {
 	data map[string][]byte
 }
 
+func TestFailureIsStoredAndCleared(t *testing.T) {
+	u, _ := url.Parse("https://example.com/app")
+	pages, failures := newMemKV(), newMemKV()
+	cache := NewCache(pages, failures)
+
+	_, found, err := cache.GetFailure(u)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	failure := domain.ScrapeFailure{
+		Reason:   domain.FailureStatus,
+		Status:   503,
+		Message:  "failed to fetch page: page responded with status 503",
+		FailedAt: time.Unix(1700000000, 0),
+	}
+	require.NoError(t, cache.StoreFailure(u, failure))
+
+	cached, found, err := cache.GetFailure(u)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, failure, cached)
+
+	// failures expire sooner than pages, so they are kept apart
+	assert.Empty(t, pages.data)
+	_, found, err = cache.GetPage(u)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// the cleared failure leaves no key behind
+	require.NoError(t, cache.ClearFailure(u))
+	assert.Empty(t, failures.data)
+	_, found, err = cache.GetFailure(u)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
 func newMemKV() *memKV {
 	return &memKV{data: make(map[string][]byte)}
 }
@@ -102,3 +222,8 @@ func (m *memKV) Put(key string, value []byte) error {
 	m.data[key] = value
 	return nil
 }
+
+func (m *memKV) Delete(key string) error {
+	delete(m.data, key)
+	return nil
+}
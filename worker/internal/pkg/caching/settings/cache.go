@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
+	"net/url"
+	"strings"
+)
+
+// keyPrefix separates settings from scraped pages when both share a KV namespace
+const keyPrefix = "settings:"
+
+type kv interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+// settingsRecord is the app settings stored in KV, it must outlive cached pages so the installed app keeps them
+type settingsRecord struct {
+	Name            string `json:"name,omitempty"`
+	ShortName       string `json:"short_name,omitempty"`
+	Display         string `json:"display,omitempty"`
+	Orientation     string `json:"orientation,omitempty"`
+	ThemeColor      string `json:"theme_color,omitempty"`
+	BackgroundColor string `json:"background_color,omitempty"`
+	StartPath       string `json:"start_path,omitempty"`
+	CacheStrategy   string `json:"cache_strategy,omitempty"`
+}
+
+type cache struct {
+	kv kv
+}
+
+func NewCache(kv kv) *cache {
+	return &cache{
+		kv: kv,
+	}
+}
+
+func (c *cache) Get(u *url.URL) (settings domain.AppSettings, found bool, err error) {
+	key := keyFromURl(u)
+
+	settingsJSON, err := c.kv.Get(key)
+	if err != nil {
+		return settings, found, fmt.Errorf("failed to read from KV (key: %s): %w", key, err)
+	}
+
+	if settingsJSON == nil {
+		return settings, false, nil
+	}
+
+	var record settingsRecord
+	err = json.Unmarshal(settingsJSON, &record)
+	if err != nil {
+		return settings, found, fmt.Errorf("failed to decode kv (key:%s): %w", key, err)
+	}
+
+	return domain.AppSettings(record), true, nil
+}
+
+func (c *cache) Store(u *url.URL, settings domain.AppSettings) error {
+	jsonValue, err := json.Marshal(settingsRecord(settings))
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+
+	err = c.kv.Put(keyFromURl(u), jsonValue)
+	if err != nil {
+		return fmt.Errorf("failed to write to KV (key:%s): %w", keyFromURl(u), err)
+	}
+
+	return nil
+}
+
+// keyFromURl keys settings the same way the links cache keys scraped pages
+func keyFromURl(u *url.URL) string {
+	key := keyPrefix + domain.SchemePathPrefix(u) + domain.KeyHost(u) + strings.TrimSuffix(u.Path, "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
@@ -0,0 +1,57 @@
+package settings
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/nazar256/intopwa/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreAndGet(t *testing.T) {
+	u, _ := url.Parse("https://mail.example.com/inbox/?tab=1")
+	kv := newMemKV()
+	cache := NewCache(kv)
+
+	_, found, err := cache.Get(u)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	settings := domain.AppSettings{
+		Name:          "Mail",
+		Display:       "fullscreen",
+		Orientation:   "portrait",
+		ThemeColor:    "#112233",
+		StartPath:     "/inbox?tab=2",
+		CacheStrategy: domain.StrategyCacheFirst,
+	}
+	require.NoError(t, cache.Store(u, settings))
+	assert.Contains(t, kv.data, "settings:mail.example.com/inbox?tab=1")
+
+	cached, found, err := cache.Get(u)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, settings, cached)
+}
+
+type memKV struct {
+	data map[string][]byte
+}
+
+func newMemKV() *memKV {
+	return &memKV{data: make(map[string][]byte)}
+}
+
+func (m *memKV) Get(key string) ([]byte, error) {
+	value, ok := m.data[key]
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (m *memKV) Put(key string, value []byte) error {
+	m.data[key] = value
+	return nil
+}
@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// colorSampleSize is the size icons are downscaled to before counting colors
+const colorSampleSize = 32
+
+// colorRenderSize is the size icons are rendered at before sampling, so colors never come from full-size frames
+const colorRenderSize = 64
+
+// IconColor returns the dominant color of the encoded icon as #rrggbb, empty if the icon has no pixels to count
+func IconColor(img []byte, mimeType string) (string, error) {
+	src, err := render(img, mimeType, colorRenderSize)
+	if err != nil {
+		return "", err
+	}
+
+	c, _ := DominantColor(src)
+
+	return c, nil
+}
+
+// DominantColor returns the most common color of the image as #rrggbb.
+// Colorful pixels are preferred over white, black and grey ones, so logos on a plain
+// background still produce their brand color. Transparent pixels are ignored.
+func DominantColor(img image.Image) (string, bool) {
+	sample := Fit(img, colorSampleSize)
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	var colorful, neutral = map[uint16]*bucket{}, map[uint16]*bucket{}
+
+	for y := sample.Bounds().Min.Y; y < sample.Bounds().Max.Y; y++ {
+		for x := sample.Bounds().Min.X; x < sample.Bounds().Max.X; x++ {
+			c := sample.NRGBAAt(x, y)
+			if c.A < 128 {
+				continue
+			}
+
+			// 4 bits per channel are enough to group shades of the same color
+			key := uint16(c.R>>4)<<8 | uint16(c.G>>4)<<4 | uint16(c.B>>4)
+
+			buckets := neutral
+			if saturation(c) > 0.25 {
+				buckets = colorful
+			}
+
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.count++
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+		}
+	}
+
+	for _, buckets := range []map[uint16]*bucket{colorful, neutral} {
+		var (
+			best    *bucket
+			bestKey uint16
+		)
+		for key, b := range buckets {
+			// the key breaks ties, so the result doesn't depend on map order
+			if best == nil || b.count > best.count || (b.count == best.count && key < bestKey) {
+				best, bestKey = b, key
+			}
+		}
+		if best != nil {
+			return Hex(color.NRGBA{
+				R: uint8(best.r / best.count),
+				G: uint8(best.g / best.count),
+				B: uint8(best.b / best.count),
+				A: 0xff,
+			}), true
+		}
+	}
+
+	return "", false
+}
+
+// Hex formats the color as #rrggbb ignoring alpha
+func Hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ParseHex parses an opaque color in the rrggbb form, the leading # is optional
+func ParseHex(value string) (color.NRGBA, bool) {
+	rgb, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || len(rgb) != 3 {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, true
+}
+
+// saturation returns HSV saturation in [0, 1]
+func saturation(c color.NRGBA) float64 {
+	maxC := max(c.R, c.G, c.B)
+	minC := min(c.R, c.G, c.B)
+	if maxC == 0 {
+		return 0
+	}
+	return float64(maxC-minC) / float64(maxC)
+}
@@ -0,0 +1,92 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDominantColor(t *testing.T) {
+	red := color.NRGBA{R: 0xe0, G: 0x10, B: 0x10, A: 0xff}
+	white := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	grey := color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		expected string
+		found    bool
+	}{
+		{
+			name: "logo on white background",
+			img: fill(colorSampleSize, func(x, y int) color.NRGBA {
+				if x > 10 && x < 20 && y > 10 && y < 20 {
+					return red
+				}
+				return white
+			}),
+			expected: "#e01010",
+			found:    true,
+		},
+		{
+			name:     "neutral only",
+			img:      fill(16, func(x, y int) color.NRGBA { return grey }),
+			expected: "#808080",
+			found:    true,
+		},
+		{
+			name:  "transparent",
+			img:   fill(16, func(x, y int) color.NRGBA { return color.NRGBA{} }),
+			found: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := DominantColor(tt.img)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func fill(size int, at func(x, y int) color.NRGBA) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetNRGBA(x, y, at(x, y))
+		}
+	}
+	return img
+}
+
+func TestIconColor(t *testing.T) {
+	img, err := os.ReadFile("tests/fixtures/icon.svg")
+	require.NoError(t, err)
+
+	c, err := IconColor(img, "image/svg+xml")
+	require.NoError(t, err)
+	assert.Equal(t, "#ff0000", c)
+
+	_, err = IconColor([]byte("not an image"), "image/png")
+	assert.Error(t, err)
+}
+
+func TestParseHex(t *testing.T) {
+	c, ok := ParseHex("#3367d6")
+	assert.True(t, ok)
+	assert.Equal(t, color.NRGBA{R: 0x33, G: 0x67, B: 0xd6, A: 0xff}, c)
+
+	c, ok = ParseHex("ffffff")
+	assert.True(t, ok)
+	assert.Equal(t, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, c)
+
+	_, ok = ParseHex("#fff")
+	assert.False(t, ok)
+	_, ok = ParseHex("red")
+	assert.False(t, ok)
+}
@@ -0,0 +1,202 @@
+// Package imaging decodes icon images and renders them into square PNG variants.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/biessek/golang-ico"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const PNGMimeType = "image/png"
+
+// MaskableSafeZone is the diameter of the central circle of a maskable icon which is never cropped by launchers
+const MaskableSafeZone = 0.8
+
+// Decode decodes PNG, JPEG, GIF, WebP, ICO and SVG images.
+// For ICO files the largest frame is returned.
+func Decode(img []byte, mimeType string) (image.Image, error) {
+	if len(img) == 0 {
+		return nil, errors.New("empty image data passed")
+	}
+
+	if mimeType == "" {
+		mimeType = http.DetectContentType(img)
+	}
+
+	switch {
+	case isICO(mimeType):
+		frames, err := ico.DecodeAll(bytes.NewReader(img))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ico: %w", err)
+		}
+		frame := largestFrame(frames)
+		if frame == nil {
+			return nil, errors.New("ico contains no frames")
+		}
+		return frame, nil
+	case isSVG(mimeType):
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(img))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode svg: %w", err)
+		}
+		return rasterizeSVG(icon, int(icon.ViewBox.W), int(icon.ViewBox.H)), nil
+	default:
+		decoded, _, err := image.Decode(bytes.NewReader(img))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		return decoded, nil
+	}
+}
+
+// Resize renders the image into a size x size PNG. The source aspect ratio is preserved,
+// the image is centered and the remaining area is left transparent.
+// SVG images are rasterized directly at the target size instead of being scaled.
+func Resize(img []byte, mimeType string, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid target size: %d", size)
+	}
+
+	dst, err := render(img, mimeType, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodePNG(dst)
+}
+
+// Maskable renders a size x size PNG for purpose "maskable": the image is fit into the square inscribed
+// in the safe zone circle and the whole square is filled with the background color,
+// so launchers may crop it into any shape without cutting the image off.
+func Maskable(img []byte, mimeType string, size int, background color.NRGBA) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid target size: %d", size)
+	}
+
+	// corners of the image stay inside the circle only when its diagonal fits the diameter
+	inner := int(float64(size) * MaskableSafeZone / math.Sqrt2)
+	src, err := render(img, mimeType, inner)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	offset := (size - inner) / 2
+	draw.Draw(dst, src.Bounds().Add(image.Pt(offset, offset)), src, image.Point{}, draw.Over)
+
+	return EncodePNG(dst)
+}
+
+// Fit scales the image to fit into a size x size square, keeping the aspect ratio.
+func Fit(src image.Image, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, fitRect(src.Bounds(), dst.Bounds()), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// render rasterizes the image into a size x size square, SVG images are rendered directly at the size
+func render(img []byte, mimeType string, size int) (*image.NRGBA, error) {
+	if mimeType == "" && len(img) > 0 {
+		mimeType = http.DetectContentType(img)
+	}
+
+	if !isSVG(mimeType) {
+		src, err := Decode(img, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		return Fit(src, size), nil
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(img))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode svg: %w", err)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), rasterizeSVG(icon, size, size), image.Point{}, draw.Src)
+
+	return dst, nil
+}
+
+// fitRect returns the largest rectangle with src proportions centered inside dst
+func fitRect(src, dst image.Rectangle) image.Rectangle {
+	sw, sh := src.Dx(), src.Dy()
+	dw, dh := dst.Dx(), dst.Dy()
+	if sw <= 0 || sh <= 0 {
+		return dst
+	}
+
+	w, h := dw, sh*dw/sw
+	if h > dh {
+		w, h = sw*dh/sh, dh
+	}
+
+	x := dst.Min.X + (dw-w)/2
+	y := dst.Min.Y + (dh-h)/2
+
+	return image.Rect(x, y, x+w, y+h)
+}
+
+func rasterizeSVG(icon *oksvg.SvgIcon, w, h int) *image.RGBA {
+	if w <= 0 || h <= 0 {
+		w, h = 1, 1
+	}
+
+	// keep the viewbox proportions inside the target area
+	target := fitRect(
+		image.Rect(0, 0, int(icon.ViewBox.W), int(icon.ViewBox.H)),
+		image.Rect(0, 0, w, h),
+	)
+	icon.SetTarget(float64(target.Min.X), float64(target.Min.Y), float64(target.Dx()), float64(target.Dy()))
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	icon.Draw(rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, rgba, rgba.Bounds())), 1)
+
+	return rgba
+}
+
+func largestFrame(frames []image.Image) image.Image {
+	var largest image.Image
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		if largest == nil || frame.Bounds().Dx()*frame.Bounds().Dy() > largest.Bounds().Dx()*largest.Bounds().Dy() {
+			largest = frame
+		}
+	}
+	return largest
+}
+
+func isICO(mimeType string) bool {
+	return strings.Contains(mimeType, "x-icon") || strings.Contains(mimeType, "vnd.microsoft.icon")
+}
+
+func isSVG(mimeType string) bool {
+	return strings.Contains(mimeType, "/svg")
+}
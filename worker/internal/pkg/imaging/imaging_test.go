@@ -0,0 +1,143 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		mimeType string
+		size     int
+	}{
+		{
+			name:     "ico upscale",
+			fixture:  "tests/fixtures/favicon.ico",
+			mimeType: "image/x-icon",
+			size:     512,
+		},
+		{
+			name:     "png downscale",
+			fixture:  "tests/fixtures/apple-touch.png",
+			mimeType: "image/png",
+			size:     192,
+		},
+		{
+			name:     "svg",
+			fixture:  "tests/fixtures/icon.svg",
+			mimeType: "image/svg+xml",
+			size:     512,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := os.ReadFile(tt.fixture)
+			require.NoError(t, err)
+
+			resized, err := Resize(img, tt.mimeType, tt.size)
+			require.NoError(t, err)
+
+			cfg, err := png.DecodeConfig(bytes.NewReader(resized))
+			require.NoError(t, err)
+			assert.Equal(t, tt.size, cfg.Width)
+			assert.Equal(t, tt.size, cfg.Height)
+		})
+	}
+}
+
+func TestResizeSVGKeepsAspectRatio(t *testing.T) {
+	img, err := os.ReadFile("tests/fixtures/icon.svg")
+	require.NoError(t, err)
+
+	resized, err := Resize(img, "image/svg+xml", 192)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+
+	// the 2:1 fixture is centered vertically, so the top row stays transparent
+	_, _, _, topAlpha := decoded.At(96, 0).RGBA()
+	assert.Zero(t, topAlpha)
+
+	r, _, _, centerAlpha := decoded.At(96, 96).RGBA()
+	assert.NotZero(t, centerAlpha)
+	assert.NotZero(t, r)
+}
+
+func TestResizeInvalid(t *testing.T) {
+	_, err := Resize(nil, "image/png", 512)
+	assert.Error(t, err)
+
+	_, err = Resize([]byte("not an image"), "image/png", 512)
+	assert.Error(t, err)
+
+	_, err = Resize([]byte("not an image"), "image/png", 0)
+	assert.Error(t, err)
+}
+
+func TestMaskable(t *testing.T) {
+	img, err := os.ReadFile("tests/fixtures/icon.svg")
+	require.NoError(t, err)
+
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	masked, err := Maskable(img, "image/svg+xml", 100, blue)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(masked))
+	require.NoError(t, err)
+	assert.Equal(t, 100, decoded.Bounds().Dx())
+	assert.Equal(t, 100, decoded.Bounds().Dy())
+
+	// the background fills the whole square including the cropped corners
+	assert.Equal(t, blue, color.NRGBAModel.Convert(decoded.At(0, 0)))
+	// the 2:1 fixture takes 56x28 in the middle of the square inscribed in the safe zone
+	assert.Equal(t, blue, color.NRGBAModel.Convert(decoded.At(50, 25)))
+	assert.Equal(t, color.NRGBA{R: 0xff, A: 0xff}, color.NRGBAModel.Convert(decoded.At(50, 50)))
+	assert.Equal(t, blue, color.NRGBAModel.Convert(decoded.At(5, 50)))
+}
+
+func TestMaskableKeepsCornersInSafeZone(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, red)
+		}
+	}
+	img, err := EncodePNG(src)
+	require.NoError(t, err)
+
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	masked, err := Maskable(img, "image/png", 100, blue)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(masked))
+	require.NoError(t, err)
+
+	// every pixel of the square source, its corners included, lies within the circle of 40% radius
+	var covered int
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if color.NRGBAModel.Convert(decoded.At(x, y)) == blue {
+				continue
+			}
+			covered++
+			for _, corner := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				distance := math.Hypot(float64(x)+corner[0]-50, float64(y)+corner[1]-50)
+				assert.LessOrEqual(t, distance, 100*MaskableSafeZone/2, "pixel %d,%d", x, y)
+			}
+		}
+	}
+	assert.NotZero(t, covered)
+}
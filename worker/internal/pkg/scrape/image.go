@@ -2,17 +2,19 @@ package scrape
 
 import (
 	"bytes"
+	"cmp"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/gen2brain/svg"
 	"github.com/nazar256/intopwa/internal/domain"
 	"image"
+	"image/png"
 	"net/http"
+	"slices"
 	"strings"
 
-	"github.com/biessek/golang-ico"
 	_ "golang.org/x/image/webp"
-	_ "image/png"
 )
 
 func decodeImgProps(img []byte, mimeType string) (domain.ImageProps, error) {
@@ -29,9 +31,17 @@ func decodeImgProps(img []byte, mimeType string) (domain.ImageProps, error) {
 	var cfg image.Config
 	var err error
 	// Decode the image config to get the size
-	if strings.Contains(mimeType, "x-icon") {
-		// Use the ICO decoder for ICO images
-		cfg, err = ico.DecodeConfig(bytes.NewReader(img))
+	if strings.Contains(mimeType, "x-icon") || strings.Contains(mimeType, "vnd.microsoft.icon") {
+		// ICO files hold several frames, every frame size is listed
+		sizes, err := icoSizes(img)
+		if err != nil {
+			return props, fmt.Errorf("failed to decode image config: %w", err)
+		}
+		props.Size = sizes[0]
+		if len(sizes) > 1 {
+			props.Sizes = sizes
+		}
+		return props, nil
 	} else if strings.Contains(mimeType, "/svg") {
 		cfg, err = svg.DecodeConfig(bytes.NewReader(img))
 	} else {
@@ -49,3 +59,94 @@ func decodeImgProps(img []byte, mimeType string) (domain.ImageProps, error) {
 
 	return props, nil
 }
+
+const (
+	icoHeaderSize = 6
+	icoEntrySize  = 16
+	icoTypeIcon   = 1
+)
+
+// icoSizes reads frame sizes of the ICO, the biggest size goes first. The directory can't list sizes over 256,
+// so sizes are read from the headers of the frames, which is what decoders allocate images for.
+func icoSizes(img []byte) ([]domain.ImageSize, error) {
+	if len(img) < icoHeaderSize {
+		return nil, errors.New("ico header is truncated")
+	}
+
+	if binary.LittleEndian.Uint16(img[0:2]) != 0 || binary.LittleEndian.Uint16(img[2:4]) != icoTypeIcon {
+		return nil, errors.New("not an ico file")
+	}
+
+	count := int(binary.LittleEndian.Uint16(img[4:6]))
+	if count == 0 {
+		return nil, errors.New("ico contains no frames")
+	}
+	if len(img) < icoHeaderSize+count*icoEntrySize {
+		return nil, errors.New("ico directory is truncated")
+	}
+
+	sizes := make([]domain.ImageSize, 0, count)
+	// the decoder reads frames one after another past the directory, whatever offsets the directory declares
+	frameOffset := icoHeaderSize + count*icoEntrySize
+	for i := 0; i < count; i++ {
+		entry := img[icoHeaderSize+i*icoEntrySize:]
+		frameSize := int(binary.LittleEndian.Uint32(entry[8:12]))
+
+		frame := img[min(frameOffset, len(img)):min(frameOffset+frameSize, len(img))]
+		frameOffset += frameSize
+
+		size, err := icoFrameSize(frame, entry)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+
+	slices.SortStableFunc(sizes, func(a, b domain.ImageSize) int {
+		return cmp.Compare(b.Width*b.Height, a.Width*a.Height)
+	})
+
+	return sizes, nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// icoFrameSize reads the size from the PNG or BMP header of the frame, the directory entry is the fallback
+func icoFrameSize(frame, entry []byte) (domain.ImageSize, error) {
+	if bytes.HasPrefix(frame, pngSignature) {
+		cfg, err := png.DecodeConfig(bytes.NewReader(frame))
+		if err != nil {
+			return domain.ImageSize{}, fmt.Errorf("failed to decode ico frame: %w", err)
+		}
+		return domain.ImageSize{Width: cfg.Width, Height: cfg.Height}, nil
+	}
+
+	if len(frame) >= 12 {
+		// BMP frames have the height of the image and its mask
+		width := abs(int(int32(binary.LittleEndian.Uint32(frame[4:8]))))
+		height := abs(int(int32(binary.LittleEndian.Uint32(frame[8:12]))))
+		if height > width {
+			height /= 2
+		}
+		return domain.ImageSize{Width: width, Height: height}, nil
+	}
+
+	return domain.ImageSize{Width: icoDimension(entry[0]), Height: icoDimension(entry[1])}, nil
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// icoDimension decodes a frame dimension, 0 stands for 256 pixels
+func icoDimension(value byte) int {
+	if value == 0 {
+		return 256
+	}
+	return int(value)
+}
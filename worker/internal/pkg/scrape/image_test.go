@@ -36,6 +36,14 @@ func Test_detectProps(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:    "truncated ico",
+			image:   icoImage[:20],
+			wantErr: true,
+			expectedProps: domain.ImageProps{
+				MimeType: "image/x-icon",
+			},
+		},
 		{
 			name:  "ico",
 			image: icoImage,
@@ -45,6 +53,11 @@ func Test_detectProps(t *testing.T) {
 					Width:  48,
 					Height: 48,
 				},
+				Sizes: []domain.ImageSize{
+					{Width: 48, Height: 48},
+					{Width: 32, Height: 32},
+					{Width: 16, Height: 16},
+				},
 			},
 		},
 	}
@@ -0,0 +1,106 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	LimitPageSize = "page size"
+	LimitIconSize = "icon size"
+	// LimitManifestSize isn't configurable, real manifests are a few kilobytes
+	LimitManifestSize = "manifest size"
+	LimitPixels       = "image pixels"
+	LimitIcons        = "icons per page"
+	LimitTimeout      = "request timeout"
+)
+
+// Limits protect the worker memory from huge or slow remote responses, zero values disable a limit
+type Limits struct {
+	MaxPageSize int64
+	MaxIconSize int64
+	// MaxPixels caps width x height of an image, it's checked on the image header before the full decode
+	MaxPixels int
+	// MaxIcons caps the number of icons downloaded for a page
+	MaxIcons int
+	// RequestTimeout caps every remote request, a sooner deadline of the context wins
+	RequestTimeout time.Duration
+}
+
+// DefaultLimits fit real pages and icons with a wide margin
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPageSize:    5 << 20,
+		MaxIconSize:    2 << 20,
+		MaxPixels:      4096 * 4096,
+		MaxIcons:       20,
+		RequestTimeout: 10 * time.Second,
+	}
+}
+
+// LimitError is returned when a remote response is rejected by Limits
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitTimeout {
+		return fmt.Sprintf("%s of %s exceeded", e.Limit, time.Duration(e.Max))
+	}
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// Timeout tells the request ran out of time, like net errors do
+func (e *LimitError) Timeout() bool {
+	return e.Limit == LimitTimeout
+}
+
+type Option func(*iconsScraper)
+
+func WithLimits(limits Limits) Option {
+	return func(s *iconsScraper) {
+		s.limits = limits
+	}
+}
+
+// withRequestTimeout derives the context of a single remote request
+func (l Limits) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.RequestTimeout)
+}
+
+// requestError reports timeouts of the request's own deadline as LimitError
+func (l Limits) requestError(parent, reqCtx context.Context, err error) error {
+	if errors.Is(reqCtx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+		return &LimitError{Limit: LimitTimeout, Max: int64(l.RequestTimeout)}
+	}
+	return err
+}
+
+// readBody reads the whole body unless it's bigger than max
+func readBody(resp *http.Response, max int64, limit string) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+
+	if resp.ContentLength > max {
+		return nil, &LimitError{Limit: limit, Max: max}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, &LimitError{Limit: limit, Max: max}
+	}
+
+	return body, nil
+}
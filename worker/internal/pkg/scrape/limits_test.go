@@ -0,0 +1,135 @@
+package scrape_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nazar256/intopwa/internal/pkg/scrape"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/huge.html":
+			_, _ = w.Write([]byte("<html><head><title>" + strings.Repeat("a", 4096) + "</title></head></html>"))
+		case "/bomb.ico":
+			w.Header().Set("Content-Type", "image/x-icon")
+			_, _ = w.Write(icoWithPNGFrame(t, 2000))
+		case "/slow.html":
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.FileServer(http.Dir("./tests")).ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	limits := scrape.DefaultLimits()
+	limits.MaxPageSize = 1024
+	limits.RequestTimeout = 50 * time.Millisecond
+
+	ctx := context.Background()
+	scraper := scrape.NewIconsScraper(server.Client(), scrape.WithLimits(limits))
+
+	t.Run("page size", func(t *testing.T) {
+		u, _ := url.Parse(server.URL + "/huge.html")
+		_, err := scraper.ScrapePage(ctx, u)
+
+		var limitErr *scrape.LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, scrape.LimitPageSize, limitErr.Limit)
+	})
+
+	t.Run("request timeout", func(t *testing.T) {
+		u, _ := url.Parse(server.URL + "/slow.html")
+		_, err := scraper.ScrapePage(ctx, u)
+
+		var limitErr *scrape.LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, scrape.LimitTimeout, limitErr.Limit)
+	})
+
+	t.Run("icon size and pixels", func(t *testing.T) {
+		pngURL, _ := url.Parse(server.URL + "/fixtures/apple-touch.png")
+		icoURL, _ := url.Parse(server.URL + "/fixtures/favicon.ico")
+
+		iconLimits := scrape.DefaultLimits()
+		iconLimits.MaxPixels = 100 * 100
+		icons, err := scrape.NewIconsScraper(server.Client(), scrape.WithLimits(iconLimits)).
+			DownloadIcons(ctx, []*url.URL{pngURL, icoURL})
+		require.NoError(t, err)
+		// the 160x160 PNG is over the pixels limit
+		require.Len(t, icons, 1)
+		assert.Equal(t, icoURL, icons[0].URL)
+
+		iconLimits = scrape.DefaultLimits()
+		iconLimits.MaxIconSize = 1024
+		icons, err = scrape.NewIconsScraper(server.Client(), scrape.WithLimits(iconLimits)).
+			DownloadIcons(ctx, []*url.URL{pngURL})
+		require.NoError(t, err)
+		assert.Empty(t, icons)
+	})
+
+	t.Run("pixels of ico frames", func(t *testing.T) {
+		// the directory of the ico claims 256x256, the PNG frame is 2000x2000
+		bombURL, _ := url.Parse(server.URL + "/bomb.ico")
+
+		iconLimits := scrape.DefaultLimits()
+		iconLimits.MaxPixels = 1000 * 1000
+		icons, err := scrape.NewIconsScraper(server.Client(), scrape.WithLimits(iconLimits)).
+			DownloadIcons(ctx, []*url.URL{bombURL})
+		require.NoError(t, err)
+		assert.Empty(t, icons)
+	})
+
+	t.Run("icons per page", func(t *testing.T) {
+		pngURL, _ := url.Parse(server.URL + "/fixtures/apple-touch.png")
+		icoURL, _ := url.Parse(server.URL + "/fixtures/favicon.ico")
+
+		iconLimits := scrape.DefaultLimits()
+		iconLimits.MaxIcons = 1
+		icons, err := scrape.NewIconsScraper(server.Client(), scrape.WithLimits(iconLimits)).
+			DownloadIcons(ctx, []*url.URL{icoURL, pngURL})
+
+		var limitErr *scrape.LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, scrape.LimitIcons, limitErr.Limit)
+		require.Len(t, icons, 1)
+		assert.Equal(t, icoURL, icons[0].URL)
+	})
+}
+
+func TestLimitError(t *testing.T) {
+	assert.Equal(t, "icon size limit of 1024 exceeded", (&scrape.LimitError{Limit: scrape.LimitIconSize, Max: 1024}).Error())
+	assert.Equal(t, "request timeout of 10s exceeded", (&scrape.LimitError{Limit: scrape.LimitTimeout, Max: int64(10 * time.Second)}).Error())
+}
+
+// icoWithPNGFrame wraps a square PNG into an ico listing it as 256x256
+func icoWithPNGFrame(t *testing.T, size int) []byte {
+	var frame bytes.Buffer
+	require.NoError(t, png.Encode(&frame, image.NewGray(image.Rect(0, 0, size, size))))
+
+	var ico bytes.Buffer
+	header := []uint16{0, 1, 1}
+	require.NoError(t, binary.Write(&ico, binary.LittleEndian, header))
+	entry := struct {
+		Width, Height, Colors, Reserved uint8
+		Planes, Bits                    uint16
+		Size, Offset                    uint32
+	}{Planes: 1, Bits: 32, Size: uint32(frame.Len()), Offset: 6 + 16}
+	require.NoError(t, binary.Write(&ico, binary.LittleEndian, entry))
+	ico.Write(frame.Bytes())
+
+	return ico.Bytes()
+}
@@ -0,0 +1,124 @@
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nazar256/intopwa/internal/domain"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const manifestSelector = "link[rel=manifest]"
+
+// maxManifestSize caps the site's manifest, real manifests are a few kilobytes
+const maxManifestSize = 1 << 20
+
+type webManifest struct {
+	Name            string             `json:"name"`
+	ShortName       string             `json:"short_name"`
+	ThemeColor      string             `json:"theme_color"`
+	BackgroundColor string             `json:"background_color"`
+	Display         string             `json:"display"`
+	Icons           []webManifestImage `json:"icons"`
+}
+
+type webManifestImage struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose"`
+}
+
+// scrapeManifestURL returns the URL of the site's web app manifest or nil if the page doesn't link one
+func (f *iconsScraper) scrapeManifestURL(doc *goquery.Document, pageURL *url.URL) (*url.URL, error) {
+	href, exists := doc.Find(manifestSelector).First().Attr("href")
+	href = strings.TrimSpace(href)
+	if !exists || href == "" {
+		return nil, nil
+	}
+
+	manifestURL, err := resolveURL(documentBaseURL(doc, pageURL), href)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest URL (%s): %w", href, err)
+	}
+	if manifestURL.Scheme == dataScheme {
+		// inline manifests are rare and there is nothing to fetch
+		return nil, nil
+	}
+
+	return manifestURL, nil
+}
+
+func (f *iconsScraper) fetchManifest(ctx context.Context, manifestURL *url.URL) (*domain.WebManifest, error) {
+	reqCtx, cancel := f.limits.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, manifestURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", mobileUserAgent)
+	req.Header.Set("Accept", "application/manifest+json,application/json;q=0.9,*/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", f.limits.requestError(ctx, reqCtx, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch manifest, status: %d", resp.StatusCode)
+	}
+
+	body, err := readBody(resp, maxManifestSize, LimitManifestSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", f.limits.requestError(ctx, reqCtx, err))
+	}
+
+	return parseManifest(bytes.NewReader(body), manifestURL)
+}
+
+// parseManifest decodes the web app manifest, icon URLs are resolved against the manifest URL as the spec requires
+func parseManifest(r io.Reader, manifestURL *url.URL) (*domain.WebManifest, error) {
+	var raw webManifest
+	err := json.NewDecoder(r).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	manifest := &domain.WebManifest{
+		Name:            strings.TrimSpace(raw.Name),
+		ShortName:       strings.TrimSpace(raw.ShortName),
+		ThemeColor:      strings.TrimSpace(raw.ThemeColor),
+		BackgroundColor: strings.TrimSpace(raw.BackgroundColor),
+		Display:         strings.TrimSpace(raw.Display),
+	}
+
+	for _, icon := range raw.Icons {
+		src := strings.TrimSpace(icon.Src)
+		if src == "" {
+			continue
+		}
+
+		iconURL, err := resolveURL(manifestURL, src)
+		if err != nil {
+			// a single broken icon shouldn't discard the rest of the manifest
+			continue
+		}
+
+		manifest.Icons = append(manifest.Icons, domain.IconLink{
+			URL:     iconURL,
+			Sizes:   strings.TrimSpace(icon.Sizes),
+			Type:    strings.TrimSpace(icon.Type),
+			Purpose: strings.TrimSpace(icon.Purpose),
+		})
+	}
+
+	return manifest, nil
+}
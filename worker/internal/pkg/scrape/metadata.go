@@ -0,0 +1,90 @@
+package scrape
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nazar256/intopwa/internal/domain"
+	"net/url"
+	"strings"
+)
+
+// maxMetadataLength caps scraped values, some sites stuff whole paragraphs into meta tags
+const maxMetadataLength = 300
+
+func scrapeMetadata(doc *goquery.Document) domain.PageMetadata {
+	metadata := domain.PageMetadata{
+		Title:           metadataValue(doc.Find("head title").First().Text()),
+		SiteName:        metaContent(doc, "meta[property='og:site_name']"),
+		ApplicationName: metaContent(doc, "meta[name=application-name]"),
+		AppleTitle:      metaContent(doc, "meta[name=apple-mobile-web-app-title]"),
+		Description:     metaContent(doc, "meta[name=description]"),
+	}
+
+	metadata.ThemeColor, metadata.ThemeColorDark = scrapeThemeColors(doc)
+
+	return metadata
+}
+
+// scrapeCanonicalURL returns the URL from <link rel=canonical> or og:url, nil when the page declares none
+func scrapeCanonicalURL(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	canonical, _ := doc.Find("link[rel=canonical]").First().Attr("href")
+	if strings.TrimSpace(canonical) == "" {
+		canonical, _ = doc.Find("meta[property='og:url']").First().Attr("content")
+	}
+	if strings.TrimSpace(canonical) == "" {
+		return nil
+	}
+
+	canonicalURL, err := resolveURL(documentBaseURL(doc, pageURL), canonical)
+	if err != nil || canonicalURL.Scheme == dataScheme {
+		return nil
+	}
+
+	return canonicalURL
+}
+
+// scrapeThemeColors returns theme colors for the light (or unspecified) and the dark color schemes.
+// Tags without media query are preferred for the light color, since they apply to every scheme.
+func scrapeThemeColors(doc *goquery.Document) (light, dark string) {
+	var lightMedia string
+
+	doc.Find("meta[name=theme-color]").Each(func(i int, s *goquery.Selection) {
+		content, _ := s.Attr("content")
+		content = strings.TrimSpace(content)
+		if !domain.ValidColor(content) {
+			return
+		}
+
+		media, _ := s.Attr("media")
+		media = strings.ToLower(strings.Join(strings.Fields(media), ""))
+
+		switch {
+		case strings.Contains(media, "prefers-color-scheme:dark"):
+			if dark == "" {
+				dark = content
+			}
+		case media == "":
+			if light == "" || lightMedia != "" {
+				light, lightMedia = content, media
+			}
+		case strings.Contains(media, "prefers-color-scheme:light"):
+			if light == "" {
+				light, lightMedia = content, media
+			}
+		}
+	})
+
+	return light, dark
+}
+
+func metaContent(doc *goquery.Document, selector string) string {
+	content, _ := doc.Find(selector).First().Attr("content")
+	return metadataValue(content)
+}
+
+func metadataValue(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if runes := []rune(value); len(runes) > maxMetadataLength {
+		value = string(runes[:maxMetadataLength])
+	}
+	return value
+}
@@ -0,0 +1,245 @@
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/nazar256/intopwa/internal/domain"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// probeConcurrency caps simultaneous requests to the site while probing well-known locations
+	probeConcurrency = 4
+	// maxBrowserConfigSize caps browserconfig.xml, real ones are a few hundred bytes
+	maxBrowserConfigSize = 64 << 10
+
+	relTile = "msapplication-tile"
+)
+
+// declaredSize matches sizes in conventional file and element names, e.g. android-chrome-512x512.png
+var declaredSize = regexp.MustCompile(`(\d+)x(\d+)`)
+
+// DefaultProbePaths are well-known locations of icons and manifests apps ship without linking them,
+// e.g. single page apps injecting their <head> at runtime
+func DefaultProbePaths() []string {
+	return []string{
+		"/apple-touch-icon.png",
+		"/apple-touch-icon-precomposed.png",
+		"/android-chrome-512x512.png",
+		"/manifest.json",
+		"/site.webmanifest",
+		"/browserconfig.xml",
+	}
+}
+
+// WithProbePaths replaces the well-known locations probed for pages linking no icons, nil disables probing
+func WithProbePaths(paths []string) Option {
+	return func(s *iconsScraper) {
+		s.probePaths = paths
+	}
+}
+
+// probeResult is what a single well-known location turned out to hold
+type probeResult struct {
+	links    []domain.IconLink
+	manifest *domain.WebManifest
+}
+
+// probeWellKnown checks the well-known locations of the site concurrently, icons are checked with HEAD requests,
+// manifests and browserconfig.xml are read only when the page doesn't link a manifest
+func (f *iconsScraper) probeWellKnown(ctx context.Context, pageURL *url.URL, withManifest bool) (links []domain.IconLink, manifest *domain.WebManifest) {
+	results := make([]probeResult, len(f.probePaths))
+
+	var probeGroup errgroup.Group
+	probeGroup.SetLimit(probeConcurrency)
+
+	for i, probePath := range f.probePaths {
+		probeURL, err := pageURL.Parse(probePath)
+		if err != nil {
+			slog.Error("failed to parse probe URL", "err", err, "path", probePath)
+			continue
+		}
+		probeURL.RawQuery = ""
+		probeURL.Fragment = ""
+
+		name := strings.ToLower(path.Base(probeURL.Path))
+		probeGroup.Go(func() error {
+			var err error
+			switch {
+			case strings.HasSuffix(name, ".webmanifest") || name == "manifest.json":
+				if withManifest {
+					results[i].manifest, err = f.fetchManifest(ctx, probeURL)
+				}
+			case name == "browserconfig.xml":
+				results[i].links, err = f.fetchBrowserConfig(ctx, probeURL)
+			default:
+				var found bool
+				found, err = f.probeIcon(ctx, probeURL)
+				if found {
+					results[i].links = []domain.IconLink{probedIconLink(probeURL)}
+				}
+			}
+			if err != nil {
+				slog.Debug("well-known location is not available", "err", err, "URL", probeURL.String())
+			}
+			return nil
+		})
+	}
+
+	_ = probeGroup.Wait()
+
+	// results keep the order of the probe paths, so the first manifest found wins
+	for _, result := range results {
+		links = append(links, result.links...)
+		if manifest == nil {
+			manifest = result.manifest
+		}
+	}
+
+	return links, manifest
+}
+
+// probeIcon checks the icon exists with a HEAD request, servers not supporting HEAD are asked with GET
+func (f *iconsScraper) probeIcon(ctx context.Context, iconURL *url.URL) (bool, error) {
+	status, contentType, err := f.probe(ctx, http.MethodHead, iconURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, contentType, err = f.probe(ctx, http.MethodGet, iconURL)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if status != http.StatusOK {
+		return false, fmt.Errorf("failed to probe icon, status: %d", status)
+	}
+
+	// SPA servers answer unknown paths with their index page
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "application/octet-stream") {
+		return false, fmt.Errorf("invalid icon content type: %s", contentType)
+	}
+
+	return true, nil
+}
+
+func (f *iconsScraper) probe(ctx context.Context, method string, u *url.URL) (status int, contentType string, err error) {
+	reqCtx, cancel := f.limits.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, method, u.String(), nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", mobileUserAgent)
+	req.Header.Set("Accept", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to probe %s: %w", u.String(), f.limits.requestError(ctx, reqCtx, err))
+	}
+	// the body of a GET fallback isn't needed, closing it drops the rest
+	_ = resp.Body.Close()
+
+	return resp.StatusCode, strings.ToLower(resp.Header.Get("Content-Type")), nil
+}
+
+// probedIconLink fills the attributes conventional names imply
+func probedIconLink(iconURL *url.URL) domain.IconLink {
+	link := domain.IconLink{URL: iconURL, Rel: "icon"}
+
+	name := strings.ToLower(path.Base(iconURL.Path))
+	if strings.HasPrefix(name, "apple-touch-icon") {
+		link.Rel = "apple-touch-icon"
+	}
+	if size := declaredSize.FindString(name); size != "" {
+		link.Sizes = size
+	}
+
+	return link
+}
+
+// fetchBrowserConfig reads tile images from browserconfig.xml of Windows pinned sites
+func (f *iconsScraper) fetchBrowserConfig(ctx context.Context, configURL *url.URL) ([]domain.IconLink, error) {
+	reqCtx, cancel := f.limits.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, configURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", mobileUserAgent)
+	req.Header.Set("Accept", "application/xml,text/xml;q=0.9,*/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch browserconfig: %w", f.limits.requestError(ctx, reqCtx, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch browserconfig, status: %d", resp.StatusCode)
+	}
+
+	body, err := readBody(resp, maxBrowserConfigSize, LimitManifestSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read browserconfig: %w", f.limits.requestError(ctx, reqCtx, err))
+	}
+
+	return parseBrowserConfig(bytes.NewReader(body), configURL)
+}
+
+// parseBrowserConfig returns tile images of the msapplication config, e.g. <square310x310logo src="..."/>
+func parseBrowserConfig(r io.Reader, configURL *url.URL) (links []domain.IconLink, err error) {
+	decoder := xml.NewDecoder(r)
+	var inTile bool
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return links, fmt.Errorf("failed to decode browserconfig: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(element.Name.Local)
+			if name == "tile" {
+				inTile = true
+				continue
+			}
+			if !inTile {
+				continue
+			}
+
+			for _, attr := range element.Attr {
+				if !strings.EqualFold(attr.Name.Local, "src") || strings.TrimSpace(attr.Value) == "" {
+					continue
+				}
+				tileURL, err := resolveURL(configURL, attr.Value)
+				if err != nil || tileURL.Scheme == dataScheme {
+					continue
+				}
+				links = append(links, domain.IconLink{
+					URL:   tileURL,
+					Sizes: declaredSize.FindString(name),
+					Rel:   relTile,
+				})
+			}
+		case xml.EndElement:
+			if strings.EqualFold(element.Name.Local, "tile") {
+				inTile = false
+			}
+		}
+	}
+}
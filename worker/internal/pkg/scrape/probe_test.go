@@ -0,0 +1,114 @@
+package scrape_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nazar256/intopwa/internal/domain"
+	"github.com/nazar256/intopwa/internal/pkg/scrape"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeWellKnownLocations(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var mu sync.Mutex
+	methods := make(map[string][]string)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		// keeps requests overlapping, so the concurrency limit is observable
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		methods[r.URL.Path] = append(methods[r.URL.Path], r.Method)
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/app":
+			_, _ = w.Write([]byte(`<html><head><title>App</title></head><body></body></html>`))
+		case "/apple-touch-icon.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/apple-touch-icon-precomposed.png":
+			// the SPA answers unknown paths with its index page
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/android-chrome-512x512.png":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+		case "/site.webmanifest":
+			_, _ = w.Write([]byte(`{"name":"Probed","icons":[{"src":"/icons/icon-192.png","sizes":"192x192"}]}`))
+		case "/browserconfig.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<browserconfig><msapplication><tile>
+<square150x150logo src="/mstile-150x150.png"/>
+<square310x310logo src="tiles/mstile-310x310.png"/>
+<TileColor>#da532c</TileColor>
+</tile></msapplication></browserconfig>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client())
+
+	u, _ := url.Parse(server.URL + "/app")
+	page, err := scraper.ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+
+	links := make(map[string]domain.IconLink)
+	for _, link := range page.IconLinks {
+		links[link.URL.Path] = link
+	}
+
+	assert.Equal(t, "apple-touch-icon", links["/apple-touch-icon.png"].Rel)
+	assert.Equal(t, "512x512", links["/android-chrome-512x512.png"].Sizes)
+	assert.NotContains(t, links, "/apple-touch-icon-precomposed.png")
+	assert.Equal(t, "310x310", links["/tiles/mstile-310x310.png"].Sizes)
+	assert.Contains(t, links, "/mstile-150x150.png")
+	// fallbacks are kept, they are ranked below everything found
+	assert.Contains(t, links, "/favicon.ico")
+
+	require.NotNil(t, page.Manifest)
+	assert.Equal(t, "Probed", page.Manifest.Name)
+
+	assert.Equal(t, []string{http.MethodHead}, methods["/apple-touch-icon.png"])
+	assert.Equal(t, []string{http.MethodHead, http.MethodGet}, methods["/android-chrome-512x512.png"])
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+}
+
+func TestProbeSkippedForPagesLinkingIcons(t *testing.T) {
+	var probed atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app" {
+			_, _ = w.Write([]byte(`<html><head><link rel="icon" href="/icon.png"></head></html>`))
+			return
+		}
+		probed.Store(true)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/app")
+	_, err := scrape.NewIconsScraper(server.Client()).ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+
+	assert.False(t, probed.Load())
+}
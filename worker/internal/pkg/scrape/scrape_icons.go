@@ -1,13 +1,14 @@
 package scrape
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/nazar256/intopwa/internal/domain"
 	"golang.org/x/sync/errgroup"
-	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
 	"slices"
@@ -34,32 +35,77 @@ var tryIconURIs = []string{
 }
 
 type iconsScraper struct {
-	client httpClient
+	client     httpClient
+	limits     Limits
+	probePaths []string
 }
 
-func NewIconsScraper(client httpClient) *iconsScraper {
+func NewIconsScraper(client httpClient, opts ...Option) *iconsScraper {
 	if client == nil {
 		panic("nil client passed")
 	}
-	return &iconsScraper{
-		client: client,
+	s := &iconsScraper{
+		client:     client,
+		limits:     DefaultLimits(),
+		probePaths: DefaultProbePaths(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// scrapIcons scraps favicon, apple-touch and shortcut icons from the given URL using goquery
-func (f *iconsScraper) ScrapeIconURLs(ctx context.Context, pageURL *url.URL) (iconURLs []*url.URL, err error) {
-	// fetch the page
-	doc, err := f.fetchPage(ctx, pageURL)
+// ScrapePage scraps favicon, apple-touch and shortcut icons, page metadata and the site's web app manifest
+// from the given URL
+func (f *iconsScraper) ScrapePage(ctx context.Context, pageURL *url.URL) (page domain.Page, err error) {
+	// fetch the page, links are resolved against the final URL after redirects
+	doc, pageURL, err := f.fetchPage(ctx, pageURL)
+	if err != nil {
+		return page, fmt.Errorf("failed to fetch page: %w", err)
+	}
+
+	page.IconLinks, err = f.scrapeIconLinks(doc, pageURL)
 	if err != nil {
-		return iconURLs, fmt.Errorf("failed to fetch page: %w", err)
+		return page, err
 	}
 
+	page.URL = pageURL
+	page.CanonicalURL = scrapeCanonicalURL(doc, pageURL)
+	page.Metadata = scrapeMetadata(doc)
+
+	manifestURL, err := f.scrapeManifestURL(doc, pageURL)
+	if err != nil {
+		slog.Error("failed to parse manifest URL", "err", err, "page", pageURL.String())
+	} else if manifestURL != nil {
+		// the site's manifest is optional, so failing to read it doesn't fail the page
+		page.Manifest, err = f.fetchManifest(ctx, manifestURL)
+		if err != nil {
+			slog.Error("failed to fetch site manifest", "err", err, "manifest", manifestURL.String())
+		}
+	}
+
+	if !declaresIcons(page) && len(f.probePaths) > 0 {
+		// icons of apps rendering their <head> with JS are looked for in well-known locations
+		probedLinks, manifest := f.probeWellKnown(ctx, pageURL, page.Manifest == nil)
+		page.IconLinks = append(probedLinks, page.IconLinks...)
+		if manifest != nil {
+			page.Manifest = manifest
+		}
+	}
+
+	return page, nil
+}
+
+// scrapeIconLinks scraps favicon, apple-touch and shortcut icons with their declared attributes from the parsed page,
+// well-known icon locations are added without any attributes
+func (f *iconsScraper) scrapeIconLinks(doc *goquery.Document, pageURL *url.URL) (iconLinks []domain.IconLink, err error) {
+	baseURL := documentBaseURL(doc, pageURL)
 	for _, selector := range iconSelectors {
-		scrapedIconURLs, err := f.scrapeIcons(doc, pageURL, selector)
+		scrapedIconLinks, err := f.scrapeIcons(doc, baseURL, selector)
 		if err != nil {
-			return iconURLs, fmt.Errorf("scrape icon error: %w", err)
+			return iconLinks, fmt.Errorf("scrape icon error: %w", err)
 		}
-		iconURLs = append(iconURLs, scrapedIconURLs...)
+		iconLinks = append(iconLinks, scrapedIconLinks...)
 	}
 
 	for _, uri := range tryIconURIs {
@@ -70,67 +116,128 @@ func (f *iconsScraper) ScrapeIconURLs(ctx context.Context, pageURL *url.URL) (ic
 		iconURLParts = append(iconURLParts, uri)
 		defaultIconURL, err := url.Parse(strings.Join(iconURLParts, ""))
 		if err != nil {
-			return iconURLs, fmt.Errorf("failed to parse default favicon URL: %w", err)
+			return iconLinks, fmt.Errorf("failed to parse default favicon URL: %w", err)
 		}
-		iconURLs = append(iconURLs, defaultIconURL)
+		iconLinks = append(iconLinks, domain.IconLink{URL: defaultIconURL})
 	}
 
-	slices.SortFunc(iconURLs, func(a, b *url.URL) int {
-		return strings.Compare(a.String(), b.String())
+	// the stable sort keeps the first link of a URL, so declared links win over well-known locations
+	slices.SortStableFunc(iconLinks, func(a, b domain.IconLink) int {
+		return strings.Compare(a.URL.String(), b.URL.String())
 	})
-	iconURLs = slices.CompactFunc(iconURLs, func(a, b *url.URL) bool {
-		return a.String() == b.String()
+	iconLinks = slices.CompactFunc(iconLinks, func(a, b domain.IconLink) bool {
+		return a.URL.String() == b.URL.String()
 	})
 
-	return iconURLs, nil
+	return iconLinks, nil
 }
 
-func (f *iconsScraper) fetchPage(ctx context.Context, url *url.URL) (*goquery.Document, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+// declaresIcons reports whether the page links any icons itself or via its manifest
+func declaresIcons(page domain.Page) bool {
+	if page.Manifest != nil && len(page.Manifest.Icons) > 0 {
+		return true
+	}
+	// well-known locations are added without a rel
+	return slices.ContainsFunc(page.IconLinks, func(link domain.IconLink) bool {
+		return link.Rel != ""
+	})
+}
+
+// fetchPage returns the parsed page and its final URL after redirects
+func (f *iconsScraper) fetchPage(ctx context.Context, url *url.URL) (*goquery.Document, *url.URL, error) {
+	reqCtx, cancel := f.limits.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, url, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", mobileUserAgent)
 
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch page: %w", err)
+		return nil, url, fmt.Errorf("failed to fetch page: %w", f.limits.requestError(ctx, reqCtx, err))
 	}
 	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if resp.Request != nil && resp.Request.URL != nil {
+		url = resp.Request.URL
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, url, &domain.ScrapeFailure{Reason: domain.FailureStatus, Status: resp.StatusCode}
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); !isHTML(contentType) {
+		return nil, url, &domain.ScrapeFailure{Reason: domain.FailureContentType, ContentType: contentType}
+	}
+
+	body, err := readBody(resp, f.limits.MaxPageSize, LimitPageSize)
+	if err != nil {
+		return nil, url, fmt.Errorf("failed to read page: %w", f.limits.requestError(ctx, reqCtx, err))
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, url, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return doc, nil
+	return doc, url, nil
 }
 
+// isHTML accepts HTML and XHTML pages, pages without the content type are parsed as HTML
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// scrapeIcons returns icons linked by the selector, hrefs are resolved against the document base URL
 func (f *iconsScraper) scrapeIcons(
 	doc *goquery.Document,
-	url *url.URL,
+	baseURL *url.URL,
 	selector string,
-) (iconURLs []*url.URL, err error) {
+) (iconLinks []domain.IconLink, err error) {
 	doc.Find(selector).Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
-		if !exists {
+		if !exists || strings.TrimSpace(href) == "" {
 			return
 		}
 
-		iconURL, parseErr := url.Parse(href)
+		iconURL, parseErr := resolveURL(baseURL, href)
 		if parseErr != nil {
-			err = fmt.Errorf("failed to parse icon URL (%s): %w", iconURL.String(), err)
+			err = fmt.Errorf("failed to parse icon URL (%s): %w", href, parseErr)
 			return
 		}
 
-		iconURLs = append(iconURLs, iconURL)
+		iconLinks = append(iconLinks, domain.IconLink{
+			URL:   iconURL,
+			Sizes: strings.TrimSpace(s.AttrOr("sizes", "")),
+			Type:  strings.ToLower(strings.TrimSpace(s.AttrOr("type", ""))),
+			Rel:   strings.ToLower(strings.TrimSpace(s.AttrOr("rel", ""))),
+			Media: strings.TrimSpace(s.AttrOr("media", "")),
+		})
 	})
 
 	return
 }
 
+// DownloadIcons downloads the icons skipping broken ones. Icons over the MaxIcons limit are skipped too,
+// the ones within it are returned along with the LimitError.
 func (f *iconsScraper) DownloadIcons(ctx context.Context, iconURLs []*url.URL) (icons []domain.Icon, err error) {
+	if f.limits.MaxIcons > 0 && len(iconURLs) > f.limits.MaxIcons {
+		err = &LimitError{Limit: LimitIcons, Max: int64(f.limits.MaxIcons)}
+		iconURLs = iconURLs[:f.limits.MaxIcons]
+	}
+
 	iconCh := make(chan domain.Icon, len(iconURLs))
 
 	var fetchGroup, collectGroup errgroup.Group
@@ -168,7 +275,18 @@ func (f *iconsScraper) DownloadIcons(ctx context.Context, iconURLs []*url.URL) (
 func (f *iconsScraper) downloadIcon(ctx context.Context, iconURL *url.URL) (icon domain.Icon, err error) {
 	icon.URL = iconURL
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iconURL.String(), nil)
+	if iconURL.Scheme == dataScheme {
+		return f.decodeInlineIcon(iconURL)
+	}
+	if domain.IsInlineIconURL(iconURL) {
+		// the data URI is known only to the page, the icon may be served from the cache only
+		return icon, fmt.Errorf("inline icon is not cached: %s", iconURL.String())
+	}
+
+	reqCtx, cancel := f.limits.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, iconURL.String(), nil)
 	if err != nil {
 		return icon, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -178,7 +296,7 @@ func (f *iconsScraper) downloadIcon(ctx context.Context, iconURL *url.URL) (icon
 
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return icon, fmt.Errorf("failed to fetch icon: %w", err)
+		return icon, fmt.Errorf("failed to fetch icon: %w", f.limits.requestError(ctx, reqCtx, err))
 	}
 	defer resp.Body.Close()
 
@@ -186,12 +304,33 @@ func (f *iconsScraper) downloadIcon(ctx context.Context, iconURL *url.URL) (icon
 		return icon, fmt.Errorf("failed to fetch icon, status: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp, f.limits.MaxIconSize, LimitIconSize)
 	if err != nil {
-		return icon, fmt.Errorf("failed to read icon body: %w", err)
+		return icon, fmt.Errorf("failed to read icon body: %w", f.limits.requestError(ctx, reqCtx, err))
 	}
 
-	contentType := resp.Header.Get("Content-Type")
+	return f.iconFromBody(icon, body, resp.Header.Get("Content-Type"))
+}
+
+// decodeInlineIcon reads the icon embedded into a data URI instead of fetching it,
+// the icon gets the stable URL of domain.InlineIconURL
+func (f *iconsScraper) decodeInlineIcon(iconURL *url.URL) (icon domain.Icon, err error) {
+	icon.URL = domain.InlineIconURL(iconURL)
+
+	contentType, body, err := decodeDataURI(iconURL)
+	if err != nil {
+		return icon, fmt.Errorf("failed to read inline icon: %w", err)
+	}
+
+	if f.limits.MaxIconSize > 0 && int64(len(body)) > f.limits.MaxIconSize {
+		return icon, &LimitError{Limit: LimitIconSize, Max: f.limits.MaxIconSize}
+	}
+
+	return f.iconFromBody(icon, body, contentType)
+}
+
+// iconFromBody checks the icon body is an image within the limits and decodes its props
+func (f *iconsScraper) iconFromBody(icon domain.Icon, body []byte, contentType string) (domain.Icon, error) {
 	if !strings.HasPrefix(contentType, "image/") {
 		detectedContentType := http.DetectContentType(body)
 		if strings.HasPrefix(detectedContentType, "image/") {
@@ -205,13 +344,18 @@ func (f *iconsScraper) downloadIcon(ctx context.Context, iconURL *url.URL) (icon
 		}
 	}
 
-	icon.Body = body
-
 	props, err := decodeImgProps(body, contentType)
 	if err != nil {
+		icon.Body = body
 		return icon, fmt.Errorf("failed to decode image props: %w", err)
 	}
 
+	// the header is checked before anything decodes the pixels, so decompression bombs are never expanded
+	if f.limits.MaxPixels > 0 && props.Size.Width*props.Size.Height > f.limits.MaxPixels {
+		return icon, &LimitError{Limit: LimitPixels, Max: int64(f.limits.MaxPixels)}
+	}
+
+	icon.Body = body
 	icon.Props = props
 
 	return icon, nil
@@ -2,9 +2,11 @@ package scrape_test
 
 import (
 	"context"
+	"encoding/base64"
 	"github.com/nazar256/intopwa/internal/domain"
 	"github.com/nazar256/intopwa/internal/pkg/scrape"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -45,7 +47,7 @@ func TestScrapIconURLs(t *testing.T) {
 			expectedURIs: []string{"/favicon.ico", "/favicon.svg"},
 		},
 		"favicon": {
-			uri:          "/fixtures/favicons-only.html",
+			uri:          "/fixtures/favicon-only.html",
 			expectedURIs: []string{"/favicon.ico", "/favicon.svg"},
 		},
 		"multiple": {
@@ -74,14 +76,15 @@ func TestScrapIconURLs(t *testing.T) {
 				srv = dummyServer
 			}
 
-			scraper := scrape.NewIconsScraper(srv.Client())
+			// well-known locations are covered by TestProbeWellKnownLocations
+			scraper := scrape.NewIconsScraper(srv.Client(), scrape.WithProbePaths(nil))
 
 			u, _ := url.Parse(srv.URL + test.uri)
-			iconURLs, err := scraper.ScrapeIconURLs(ctx, u)
+			page, err := scraper.ScrapePage(ctx, u)
 			assert.NoError(t, err)
 
 			var iconURLStrings []string
-			for _, u := range iconURLs {
+			for _, u := range domain.IconURLs(page.IconLinks) {
 				iconURLStrings = append(
 					iconURLStrings,
 					strings.Join(
@@ -101,3 +104,204 @@ func TestScrapIconURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestScrapePageManifest(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("./tests")))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client())
+
+	u, _ := url.Parse(server.URL + "/fixtures/with-manifest.html")
+	page, err := scraper.ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+	require.NotNil(t, page.Manifest)
+
+	assert.Equal(t, "Example Application", page.Manifest.Name)
+	assert.Equal(t, "Example", page.Manifest.ShortName)
+	assert.Equal(t, "#112233", page.Manifest.ThemeColor)
+	assert.Equal(t, "#ffffff", page.Manifest.BackgroundColor)
+	assert.Equal(t, "standalone", page.Manifest.Display)
+
+	require.Len(t, page.Manifest.Icons, 2)
+	assert.Equal(t, server.URL+"/fixtures/icons/icon-512.png", page.Manifest.Icons[0].URL.String())
+	assert.Equal(t, "512x512", page.Manifest.Icons[0].Sizes)
+	assert.Equal(t, "image/png", page.Manifest.Icons[0].Type)
+	assert.Equal(t, "any", page.Manifest.Icons[0].Purpose)
+	assert.Equal(t, server.URL+"/fixtures/icons/maskable.png", page.Manifest.Icons[1].URL.String())
+	assert.Equal(t, "maskable", page.Manifest.Icons[1].Purpose)
+
+	var allURLs []string
+	for _, link := range page.IconCandidates() {
+		allURLs = append(allURLs, link.URL.Path)
+	}
+	assert.Contains(t, allURLs, "/fixtures/apple-touch.png")
+	assert.Contains(t, allURLs, "/fixtures/icons/maskable.png")
+}
+
+func TestScrapeIconLinkAttributes(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("./tests")))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client())
+
+	u, _ := url.Parse(server.URL + "/fixtures/icon-links.html")
+	page, err := scraper.ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+
+	links := make(map[string]domain.IconLink, len(page.IconLinks))
+	for _, link := range page.IconLinks {
+		links[link.URL.Path] = link
+	}
+
+	assert.Equal(t, domain.IconLink{
+		URL:   links["/fixtures/icon-32.png"].URL,
+		Sizes: "32x32",
+		Type:  "image/png",
+		Rel:   "icon",
+	}, links["/fixtures/icon-32.png"])
+	assert.True(t, links["/fixtures/icon.svg"].IsScalable())
+	assert.Equal(t, "(prefers-color-scheme: dark)", links["/fixtures/icon-dark.png"].Media)
+	assert.Equal(t, "apple-touch-icon", links["/fixtures/apple-touch.png"].Rel)
+	assert.Equal(t, 180, links["/fixtures/apple-touch.png"].MaxSize())
+
+	// well-known locations are probed without attributes
+	assert.Equal(t, domain.IconLink{URL: links["/favicon.ico"].URL}, links["/favicon.ico"])
+}
+
+func TestScrapeResolvesIconURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			http.Redirect(w, r, "/fixtures/base-href.html", http.StatusFound)
+		case "/static/site.webmanifest":
+			_, _ = w.Write([]byte(`{"name":"Example","icons":[{"src":"icon-512.png#any","sizes":"512x512"}]}`))
+		default:
+			http.FileServer(http.Dir("./tests")).ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client())
+
+	u, _ := url.Parse(server.URL + "/app")
+	page, err := scraper.ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+
+	assert.Equal(t, server.URL+"/fixtures/base-href.html", page.URL.String())
+	assert.Equal(t, server.URL+"/app", page.CanonicalURL.String())
+
+	var iconURLs []string
+	for _, link := range page.IconCandidates() {
+		iconURLs = append(iconURLs, link.URL.String())
+	}
+
+	assert.Contains(t, iconURLs, server.URL+"/static/icon.png")
+	assert.Contains(t, iconURLs, "http://cdn.example.com/apple-touch.png")
+	assert.Contains(t, iconURLs, server.URL+"/favicon.ico")
+	assert.Contains(t, iconURLs, server.URL+"/static/icon-512.png")
+	for _, iconURL := range iconURLs {
+		assert.NotContains(t, iconURL, "#v2")
+	}
+
+	// data URIs keep their payload, "#" there isn't a fragment
+	inline := slices.IndexFunc(iconURLs, func(u string) bool { return strings.HasPrefix(u, "data:image/svg+xml,") })
+	if assert.NotEqual(t, -1, inline) {
+		assert.Contains(t, iconURLs[inline], "fill='#fff'")
+	}
+}
+
+func TestDownloadInlineIcons(t *testing.T) {
+	const svgIcon = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16"><rect fill="#fff" width="16" height="16"/></svg>`
+
+	scraper := scrape.NewIconsScraper(http.DefaultClient)
+
+	base64Icon := &url.URL{Scheme: "data", Opaque: "image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svgIcon))}
+	escapedIcon := &url.URL{Scheme: "data", Opaque: "image/svg+xml," + strings.ReplaceAll(svgIcon, " ", "%20")}
+
+	icons, err := scraper.DownloadIcons(context.Background(), []*url.URL{base64Icon, escapedIcon})
+	require.NoError(t, err)
+	require.Len(t, icons, 2)
+
+	for _, icon := range icons {
+		assert.Equal(t, []byte(svgIcon), icon.Body)
+		assert.Equal(t, "image/svg+xml", icon.Props.MimeType)
+		assert.True(t, domain.IsInlineIconURL(icon.URL))
+		assert.Regexp(t, `^/i/[0-9a-f]{32}\.inline\.invalid/icon\.svg$`, icon.Path())
+	}
+
+	// the stable URL is served from the cache only, it's never fetched
+	icons, err = scraper.DownloadIcons(context.Background(), []*url.URL{domain.InlineIconURL(base64Icon)})
+	assert.NoError(t, err)
+	assert.Empty(t, icons)
+}
+
+func TestScrapePageMetadata(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("./tests")))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client())
+
+	u, _ := url.Parse(server.URL + "/fixtures/metadata.html")
+	page, err := scraper.ScrapePage(context.Background(), u)
+	require.NoError(t, err)
+
+	assert.Equal(t, domain.PageMetadata{
+		Title:           "Inbox - Example Mail",
+		SiteName:        "Example Mail",
+		ApplicationName: "Example Mail Web",
+		AppleTitle:      "Mail",
+		Description:     "Secure email for everyone.",
+		ThemeColor:      "#3367d6",
+		ThemeColorDark:  "#111111",
+	}, page.Metadata)
+}
+
+func TestScrapePageFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		case "/xhtml":
+			w.Header().Set("Content-Type", "application/xhtml+xml; charset=utf-8")
+			_, _ = w.Write([]byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>XHTML</title></head></html>`))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	scraper := scrape.NewIconsScraper(server.Client(), scrape.WithProbePaths(nil))
+
+	tests := map[string]struct {
+		path     string
+		expected *domain.ScrapeFailure
+	}{
+		"error status": {
+			path:     "/down",
+			expected: &domain.ScrapeFailure{Reason: domain.FailureStatus, Status: http.StatusServiceUnavailable},
+		},
+		"not HTML": {
+			path:     "/pdf",
+			expected: &domain.ScrapeFailure{Reason: domain.FailureContentType, ContentType: "application/pdf"},
+		},
+		"XHTML": {
+			path: "/xhtml",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, _ := url.Parse(server.URL + test.path)
+			_, err := scraper.ScrapePage(context.Background(), u)
+			if test.expected == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var failure *domain.ScrapeFailure
+			require.ErrorAs(t, err, &failure)
+			assert.Equal(t, test.expected, failure)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package scrape
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"strings"
+)
+
+const dataScheme = "data"
+
+// resolveURL resolves the href of a page or manifest against base, fragments are dropped.
+// Data URIs are kept as opaque URLs since their payload may contain unescaped "#".
+func resolveURL(base *url.URL, href string) (*url.URL, error) {
+	href = strings.TrimSpace(href)
+	if scheme, payload, found := strings.Cut(href, ":"); found && strings.EqualFold(scheme, dataScheme) {
+		return &url.URL{Scheme: dataScheme, Opaque: payload}, nil
+	}
+
+	u, err := base.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u, nil
+}
+
+// documentBaseURL returns the URL relative links of the document resolve against:
+// the <base href> of the page or the page URL itself
+func documentBaseURL(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	href, exists := doc.Find("base[href]").First().Attr("href")
+	if !exists || strings.TrimSpace(href) == "" {
+		return pageURL
+	}
+
+	baseURL, err := resolveURL(pageURL, href)
+	if err != nil || baseURL.Scheme == dataScheme {
+		return pageURL
+	}
+
+	return baseURL
+}
+
+// decodeDataURI returns the media type and the payload of a data URI
+func decodeDataURI(u *url.URL) (mimeType string, body []byte, err error) {
+	if u.Scheme != dataScheme {
+		return "", nil, fmt.Errorf("not a data URI: %s", u.Scheme)
+	}
+
+	meta, payload, found := strings.Cut(u.Opaque, ",")
+	if !found {
+		return "", nil, errors.New("invalid data URI: no payload")
+	}
+
+	params := strings.Split(meta, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(params[0]))
+
+	if strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64") {
+		body, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode base64 data URI: %w", err)
+		}
+		return mimeType, body, nil
+	}
+
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		// browsers keep invalid escapes as is
+		decoded = payload
+	}
+
+	return mimeType, []byte(decoded), nil
+}
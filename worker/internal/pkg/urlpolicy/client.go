@@ -0,0 +1,116 @@
+package urlpolicy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxRedirects matches the limit of net/http
+const maxRedirects = 10
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// client checks every URL it fetches including redirect targets.
+// The wrapped client must not follow redirects itself.
+type client struct {
+	next     httpClient
+	policy   Policy
+	resolver resolver
+}
+
+// NewClient wraps the client with the policy. Host names are resolved and checked when the resolver is set,
+// runtimes without DNS access pass nil and only get IP literals checked.
+func NewClient(next httpClient, policy Policy, resolver resolver) *client {
+	if next == nil {
+		panic("nil client passed")
+	}
+
+	return &client{
+		next:     next,
+		policy:   policy,
+		resolver: resolver,
+	}
+}
+
+func (c *client) Do(req *http.Request) (*http.Response, error) {
+	for redirects := 0; ; redirects++ {
+		err := c.check(req)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.next.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			if resp.Request == nil {
+				resp.Request = req
+			}
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		_ = resp.Body.Close()
+
+		if redirects == maxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		next, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse redirect location (%s): %w", location, err)
+		}
+
+		req, err = redirectRequest(req, resp.StatusCode, next.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *client) check(req *http.Request) error {
+	err := c.policy.CheckURL(req.URL)
+	if err != nil {
+		return err
+	}
+
+	if c.resolver == nil {
+		return nil
+	}
+
+	return c.policy.CheckHost(req.Context(), c.resolver, req.URL)
+}
+
+// redirectRequest builds the request to the redirect target, 303 and POST redirects become GET as in net/http
+func redirectRequest(req *http.Request, status int, location string) (*http.Request, error) {
+	method := req.Method
+	if status == http.StatusSeeOther || (method == http.MethodPost && (status == http.StatusMovedPermanently || status == http.StatusFound)) {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return nil, fmt.Errorf("redirect of %s request is not supported", req.Method)
+	}
+
+	next, err := http.NewRequestWithContext(req.Context(), method, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redirect request: %w", err)
+	}
+	next.Header = req.Header.Clone()
+
+	return next, nil
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package urlpolicy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubClient answers with redirects from the map and 200 for any other URL
+type stubClient struct {
+	redirects map[string]string
+	requested []string
+}
+
+func (s *stubClient) Do(req *http.Request) (*http.Response, error) {
+	s.requested = append(s.requested, req.URL.String())
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+	}
+	if location, ok := s.redirects[req.URL.String()]; ok {
+		resp.StatusCode = http.StatusFound
+		resp.Header.Set("Location", location)
+	}
+
+	return resp, nil
+}
+
+func TestClientFollowsAllowedRedirects(t *testing.T) {
+	stub := &stubClient{redirects: map[string]string{
+		"https://example.com/":         "/home",
+		"https://example.com/home":     "https://www.example.com/home",
+		"https://www.example.com/home": "https://cdn.example.com/page",
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.Header.Set("User-Agent", "test")
+
+	resp, err := NewClient(stub, DefaultPolicy(), nil).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://cdn.example.com/page", resp.Request.URL.String())
+	assert.Equal(t, "test", resp.Request.Header.Get("User-Agent"))
+	assert.Len(t, stub.requested, 4)
+}
+
+func TestClientBlocksRedirectToInternalHost(t *testing.T) {
+	stub := &stubClient{redirects: map[string]string{
+		"https://example.com/": "http://169.254.169.254/latest/meta-data",
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	// plain HTTP is allowed, so the internal host is what blocks the redirect
+	_, err := NewClient(stub, DefaultPolicy().WithHTTP(), nil).Do(req)
+	assert.ErrorIs(t, err, ErrBlocked)
+	assert.ErrorContains(t, err, "169.254.169.254")
+	assert.Equal(t, []string{"https://example.com/"}, stub.requested)
+}
+
+func TestClientBlocksBeforeRequest(t *testing.T) {
+	stub := &stubClient{}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+
+	_, err := NewClient(stub, DefaultPolicy().WithHTTP(), nil).Do(req)
+	assert.ErrorIs(t, err, ErrBlocked)
+	assert.Empty(t, stub.requested)
+}
+
+func TestClientStopsRedirectLoops(t *testing.T) {
+	stub := &stubClient{redirects: map[string]string{
+		"https://example.com/a": "/b",
+		"https://example.com/b": "/a",
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/a", nil)
+
+	_, err := NewClient(stub, DefaultPolicy(), nil).Do(req)
+	assert.ErrorContains(t, err, "redirects")
+}
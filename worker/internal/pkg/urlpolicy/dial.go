@@ -0,0 +1,31 @@
+package urlpolicy
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+// DialControl checks the address a connection is actually made to, so DNS answers changing between
+// the policy check and the dial can't point requests to internal hosts. Use it as net.Dialer.Control.
+func (p Policy) DialControl(_, address string, _ syscall.RawConn) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: invalid address %s", ErrBlocked, address)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || !slices.Contains(p.Ports, port) {
+		return fmt.Errorf("%w: port %s is not allowed", ErrBlocked, portStr)
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: invalid address %s", ErrBlocked, address)
+	}
+
+	return CheckIP(ip)
+}
@@ -0,0 +1,96 @@
+// Code generated by mockery v2.43.2. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+	net "net"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Resolver is an autogenerated mock type for the resolver type
+type Resolver struct {
+	mock.Mock
+}
+
+type Resolver_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *Resolver) EXPECT() *Resolver_Expecter {
+	return &Resolver_Expecter{mock: &_m.Mock}
+}
+
+// LookupIPAddr provides a mock function with given fields: ctx, host
+func (_m *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ret := _m.Called(ctx, host)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LookupIPAddr")
+	}
+
+	var r0 []net.IPAddr
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]net.IPAddr, error)); ok {
+		return rf(ctx, host)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []net.IPAddr); ok {
+		r0 = rf(ctx, host)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]net.IPAddr)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, host)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Resolver_LookupIPAddr_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'LookupIPAddr'
+type Resolver_LookupIPAddr_Call struct {
+	*mock.Call
+}
+
+// LookupIPAddr is a helper method to define mock.On call
+//   - ctx context.Context
+//   - host string
+func (_e *Resolver_Expecter) LookupIPAddr(ctx interface{}, host interface{}) *Resolver_LookupIPAddr_Call {
+	return &Resolver_LookupIPAddr_Call{Call: _e.mock.On("LookupIPAddr", ctx, host)}
+}
+
+func (_c *Resolver_LookupIPAddr_Call) Run(run func(ctx context.Context, host string)) *Resolver_LookupIPAddr_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Resolver_LookupIPAddr_Call) Return(_a0 []net.IPAddr, _a1 error) *Resolver_LookupIPAddr_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Resolver_LookupIPAddr_Call) RunAndReturn(run func(context.Context, string) ([]net.IPAddr, error)) *Resolver_LookupIPAddr_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewResolver creates a new instance of Resolver. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewResolver(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Resolver {
+	mock := &Resolver{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
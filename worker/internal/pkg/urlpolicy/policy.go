@@ -0,0 +1,203 @@
+// Package urlpolicy guards outgoing requests to user supplied URLs against SSRF: only public hosts
+// on allowed schemes and ports are fetched, redirects are checked the same way.
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrBlocked is returned for URLs the policy doesn't allow to fetch
+var ErrBlocked = errors.New("URL is blocked by policy")
+
+// nonPublicPrefixes are special purpose ranges netip doesn't classify as private, loopback or link-local
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, includes broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, embeds IPv4 addresses
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// defaultDenyHosts are names resolving to the local machine without DNS
+var defaultDenyHosts = []string{"localhost", "*.localhost"}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.43.2 --dir=. --name resolver --output ./mocks --outpkg mocks --case underscore  --with-expecter --exported
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type Policy struct {
+	Schemes []string
+	Ports   []int
+	// AllowHosts restricts fetches to matching hosts when not empty
+	AllowHosts []string
+	// DenyHosts are never fetched, patterns are host names or "*.example.com" for any subdomain
+	DenyHosts []string
+}
+
+// DefaultPolicy allows public HTTPS hosts on the standard ports, plain HTTP is opted into with WithHTTP
+func DefaultPolicy() Policy {
+	return Policy{
+		Schemes: []string{"https"},
+		Ports:   []int{80, 443},
+	}
+}
+
+// WithHTTP allows plain HTTP in addition to the schemes of the policy
+func (p Policy) WithHTTP() Policy {
+	if !slices.Contains(p.Schemes, "http") {
+		p.Schemes = append(slices.Clone(p.Schemes), "http")
+	}
+	return p
+}
+
+// CheckURL validates the scheme, port and host name of the URL without resolving it.
+// Hosts given as IP addresses must be public.
+func (p Policy) CheckURL(u *url.URL) error {
+	if u == nil {
+		return fmt.Errorf("%w: empty URL", ErrBlocked)
+	}
+
+	if !slices.Contains(p.Schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrBlocked, u.Scheme)
+	}
+
+	port, err := urlPort(u)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBlocked, err)
+	}
+	if !slices.Contains(p.Ports, port) {
+		return fmt.Errorf("%w: port %d is not allowed", ErrBlocked, port)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrBlocked)
+	}
+	if matchesAny(host, defaultDenyHosts) || matchesAny(host, p.DenyHosts) {
+		return fmt.Errorf("%w: host %s is denied", ErrBlocked, host)
+	}
+	if len(p.AllowHosts) > 0 && !matchesAny(host, p.AllowHosts) {
+		return fmt.Errorf("%w: host %s is not allowed", ErrBlocked, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckIP(addr)
+	}
+
+	return nil
+}
+
+// CheckHost resolves the URL host and checks every address it resolves to
+func (p Policy) CheckHost(ctx context.Context, r resolver, u *url.URL) error {
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		// IP hosts are checked by CheckURL
+		return nil
+	}
+
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+
+	for _, addr := range addrs {
+		ip, ok := netip.AddrFromSlice(addr.IP)
+		if !ok {
+			return fmt.Errorf("%w: invalid address of %s", ErrBlocked, host)
+		}
+		if err := CheckIP(ip); err != nil {
+			return fmt.Errorf("%s resolves to a blocked address: %w", host, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckIP blocks loopback, private, link-local, multicast and other non-public addresses
+func CheckIP(ip netip.Addr) error {
+	ip = ip.Unmap()
+	if !ip.IsValid() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return fmt.Errorf("%w: address %s is not public", ErrBlocked, ip)
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: address %s is not public", ErrBlocked, ip)
+		}
+	}
+
+	return nil
+}
+
+// ParseHostPatterns splits a comma separated list of host patterns
+func ParseHostPatterns(list string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(strings.ToLower(pattern))
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// matchesAny matches exact host names, "*.example.com" matches subdomains of example.com
+// but neither example.com itself nor hosts like evilexample.com
+func matchesAny(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if domain, ok := strings.CutPrefix(pattern, "*"); ok {
+			domain = strings.TrimPrefix(domain, ".")
+			if domain != "" && strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func urlPort(u *url.URL) (int, error) {
+	if u.Port() == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			return 80, nil
+		case "https":
+			return 443, nil
+		}
+		return 0, fmt.Errorf("no default port for scheme %q", u.Scheme)
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", u.Port())
+	}
+
+	return port, nil
+}
@@ -0,0 +1,130 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/nazar256/intopwa/internal/pkg/urlpolicy/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyWithHTTP(t *testing.T) {
+	u, _ := url.Parse("http://example.com/")
+
+	assert.ErrorIs(t, DefaultPolicy().CheckURL(u), ErrBlocked)
+	assert.NoError(t, DefaultPolicy().WithHTTP().CheckURL(u))
+	assert.Equal(t, []string{"https"}, DefaultPolicy().Schemes)
+}
+
+func TestCheckURL(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.DenyHosts = []string{"*.blocked.example", "evil.example"}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{url: "https://example.com/favicon.ico", allowed: true},
+		{url: "http://example.com:80/", allowed: false},
+		{url: "https://93.184.215.14/", allowed: true},
+		{url: "ftp://example.com/", allowed: false},
+		{url: "file:///etc/passwd", allowed: false},
+		{url: "https://example.com:8080/", allowed: false},
+		{url: "https://localhost/", allowed: false},
+		{url: "https://api.localhost/", allowed: false},
+		{url: "https://127.0.0.1/", allowed: false},
+		{url: "https://169.254.169.254/latest/meta-data", allowed: false},
+		{url: "https://10.0.0.1/", allowed: false},
+		{url: "https://192.168.1.1/", allowed: false},
+		{url: "https://172.16.0.1/", allowed: false},
+		{url: "https://100.64.0.1/", allowed: false},
+		{url: "https://[::1]/", allowed: false},
+		{url: "https://[::ffff:127.0.0.1]/", allowed: false},
+		{url: "https://[fd00::1]/", allowed: false},
+		{url: "https://0.0.0.0/", allowed: false},
+		{url: "https://evil.example/", allowed: false},
+		{url: "https://cdn.blocked.example/", allowed: false},
+		{url: "https://blocked.example/", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			assert.NoError(t, err)
+
+			err = policy.CheckURL(u)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrBlocked)
+			}
+		})
+	}
+}
+
+func TestCheckURLAllowList(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.AllowHosts = ParseHostPatterns(" example.com, *.example.org, *example.net ")
+
+	for rawURL, allowed := range map[string]bool{
+		"https://example.com/":         true,
+		"https://www.example.org/":     true,
+		"https://a.b.example.org/":     true,
+		"https://example.org/":         false,
+		"https://evilexample.org/":     false,
+		"https://www.example.net/":     true,
+		"https://evilexample.net/":     false,
+		"https://example.org.evil.io/": false,
+		"https://other.com/":           false,
+	} {
+		u, _ := url.Parse(rawURL)
+		assert.Equal(t, allowed, policy.CheckURL(u) == nil, rawURL)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://rebind.example/")
+
+	r := mocks.NewResolver(t)
+	r.EXPECT().LookupIPAddr(ctx, "rebind.example").Return([]net.IPAddr{
+		{IP: net.ParseIP("93.184.215.14")},
+		{IP: net.ParseIP("10.0.0.5")},
+	}, nil).Once()
+
+	err := DefaultPolicy().CheckHost(ctx, r, u)
+	assert.ErrorIs(t, err, ErrBlocked)
+
+	public, _ := url.Parse("https://example.com/")
+	r.EXPECT().LookupIPAddr(ctx, "example.com").Return([]net.IPAddr{
+		{IP: net.ParseIP("93.184.215.14")},
+	}, nil).Once()
+	assert.NoError(t, DefaultPolicy().CheckHost(ctx, r, public))
+
+	failing, _ := url.Parse("https://nxdomain.example/")
+	r.EXPECT().LookupIPAddr(ctx, "nxdomain.example").Return(nil, errors.New("no such host")).Once()
+	err = DefaultPolicy().CheckHost(ctx, r, failing)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrBlocked)
+}
+
+func TestDialControl(t *testing.T) {
+	policy := DefaultPolicy()
+
+	assert.NoError(t, policy.DialControl("tcp", "93.184.215.14:443", nil))
+	assert.ErrorIs(t, policy.DialControl("tcp", "127.0.0.1:443", nil), ErrBlocked)
+	assert.ErrorIs(t, policy.DialControl("tcp", "93.184.215.14:22", nil), ErrBlocked)
+	assert.ErrorIs(t, policy.DialControl("tcp6", "[fe80::1]:80", nil), ErrBlocked)
+}
+
+func TestCheckIP(t *testing.T) {
+	assert.NoError(t, CheckIP(netip.MustParseAddr("1.1.1.1")))
+	assert.NoError(t, CheckIP(netip.MustParseAddr("2606:4700:4700::1111")))
+	assert.ErrorIs(t, CheckIP(netip.MustParseAddr("198.18.0.1")), ErrBlocked)
+	assert.ErrorIs(t, CheckIP(netip.MustParseAddr("224.0.0.1")), ErrBlocked)
+	assert.ErrorIs(t, CheckIP(netip.MustParseAddr("64:ff9b::a00:1")), ErrBlocked)
+}
@@ -4,12 +4,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/nazar256/intopwa/internal/domain/icons"
 	"github.com/nazar256/intopwa/internal/domain/server"
 	cache_icons "github.com/nazar256/intopwa/internal/pkg/caching/icons"
 	"github.com/nazar256/intopwa/internal/pkg/caching/links"
+	"github.com/nazar256/intopwa/internal/pkg/caching/settings"
 	"github.com/nazar256/intopwa/internal/pkg/scrape"
+	"github.com/nazar256/intopwa/internal/pkg/urlpolicy"
 	compat_cf "github.com/nazar256/intopwa/pkg/compatibility/cloudflare"
 	"github.com/syumai/workers"
 	"github.com/syumai/workers/cloudflare"
@@ -21,6 +24,7 @@ import (
 const (
 	iconsKVNamespace = "ICONS"
 	linksKVNamespace = "LINKS"
+	iconsR2Bucket    = "ICON_BLOBS"
 	thirtyDays       = 30 * 24 * time.Hour
 )
 
@@ -32,7 +36,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	scraper := scrape.NewIconsScraper(compat_cf.NewFetcher())
+	// ALLOW_HTTP is a var of wrangler.toml, plain HTTP apps and icons are fetched only when it's "true"
+	policy := urlpolicy.DefaultPolicy()
+	if cloudflare.Getenv("ALLOW_HTTP") == "true" {
+		policy = policy.WithHTTP()
+	}
+
+	// Workers have no DNS access, so only IP hosts are checked, Cloudflare doesn't route to private networks anyway
+	scraper := scrape.NewIconsScraper(urlpolicy.NewClient(compat_cf.NewFetcher(), policy, nil))
 
 	iconsKV, err := cloudflare.NewKVNamespace(iconsKVNamespace)
 	if err != nil {
@@ -46,14 +57,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	iconsBucket, err := cloudflare.NewR2Bucket(iconsR2Bucket)
+	if err != nil {
+		slog.Error("failed to initialize R2 bucket", "err", err, "bucket", iconsR2Bucket)
+		os.Exit(1)
+	}
+
 	iconsKVWrapper := compat_cf.NewKV(iconsKV, thirtyDays)
 	linksKVWrapper := compat_cf.NewKV(linksKV, thirtyDays)
 
-	iconsCache := cache_icons.NewCache(iconsKVWrapper)
-	linksCache := links.NewCache(linksKVWrapper)
+	iconsCache := cache_icons.NewCache(iconsKVWrapper, compat_cf.NewBucket(iconsBucket))
+	// scrape failures share the links namespace, but expire as soon as they are retried anyway
+	linksCache := links.NewCache(linksKVWrapper, compat_cf.NewKV(linksKV, icons.DefaultFailureTTL))
+	// settings share the links namespace, but never expire since the installed app relies on them
+	settingsCache := settings.NewCache(compat_cf.NewKV(linksKV, 0))
 
-	fetcher := icons.NewIconsFetcher(scraper, iconsCache, linksCache)
+	// stale entries are refreshed after the response is sent, waitUntil keeps the worker alive meanwhile
+	fetcher := icons.NewIconsFetcher(scraper, iconsCache, linksCache, settingsCache,
+		icons.WithRefresh(icons.DefaultSoftTTL, func(task func(ctx context.Context)) {
+			cloudflare.WaitUntil(func() {
+				task(context.Background())
+			})
+		}),
+	)
 
-	srv := server.New(fetcher)
+	// CORS_ORIGINS is a var of wrangler.toml, e.g. the frontend origin reading the API
+	srv := server.New(fetcher, server.WithAllowedOrigins(server.ParseOrigins(cloudflare.Getenv("CORS_ORIGINS"))...))
 	workers.Serve(srv.Router())
 }
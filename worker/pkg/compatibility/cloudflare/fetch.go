@@ -38,8 +38,9 @@ func (f *fetcher) Do(req *http.Request) (resp *http.Response, err error) {
 	}
 
 	resp, err = f.client.Do(cfReq, &fetch.RequestInit{
-		CF:       &fetch.RequestInitCF{},
-		Redirect: fetch.RedirectModeFollow,
+		CF: &fetch.RequestInitCF{},
+		// redirects are followed by the caller, so every target can be checked
+		Redirect: fetch.RedirectModeManual,
 	})
 	if err != nil {
 		return resp, fmt.Errorf("failed to perform HTTP request: %w", err)
@@ -39,3 +39,7 @@ func (k *kv) Put(key string, value []byte) error {
 		ExpirationTTL: int(k.ttl / time.Second),
 	})
 }
+
+func (k *kv) Delete(key string) error {
+	return k.namespace.Delete(key)
+}
@@ -14,22 +14,34 @@ type r2 struct {
 }
 
 func NewBucket(bucket *cloudflare.R2Bucket) *r2 {
+	if bucket == nil {
+		panic("bucket is nil")
+	}
+
 	return &r2{
 		bucket: bucket,
 	}
 }
 
+// Get returns a nil reader when the object doesn't exist
 func (r *r2) Get(path string) (io.Reader, error) {
 	obj, err := r.bucket.Get(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from R2 path: %w", err)
 	}
 
+	if obj == nil {
+		return nil, nil
+	}
+
 	return obj.Body, nil
 }
 
-func (r *r2) Put(path string, data io.ReadCloser) error {
-	_, err := r.bucket.Put(path, data, nil)
+func (r *r2) Put(path string, data io.Reader) error {
+	_, err := r.bucket.Put(path, io.NopCloser(data), nil)
+	if err != nil {
+		return fmt.Errorf("failed to write to R2 path: %w", err)
+	}
 
-	return err
+	return nil
 }
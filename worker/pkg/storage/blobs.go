@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// blobDir keeps blobs as plain files, blob paths are mapped to nested file paths
+type blobDir struct {
+	path string
+}
+
+func NewBlobDir(path string) (*blobDir, error) {
+	err := os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob directory (%s): %w", path, err)
+	}
+
+	return &blobDir{
+		path: path,
+	}, nil
+}
+
+// Get returns a nil reader when the blob doesn't exist
+func (b *blobDir) Get(path string) (io.Reader, error) {
+	filePath, err := b.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob (%s): %w", path, err)
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+func (b *blobDir) Put(path string, data io.Reader) error {
+	filePath, err := b.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write blob (%s): %w", path, err)
+	}
+
+	err = os.Rename(tmp.Name(), filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace blob (%s): %w", path, err)
+	}
+
+	return nil
+}
+
+// filePath keeps the blob inside the directory, cleaning a rooted path drops any leading ".." elements
+func (b *blobDir) filePath(path string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash("/" + path))
+	if cleaned == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid blob path: %s", path)
+	}
+	return filepath.Join(b.path, cleaned), nil
+}
+
+type kvStore interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+// kvBlobs exposes a key-value store as a blob store, e.g. to keep blobs in memory or in bolt
+type kvBlobs struct {
+	kv kvStore
+}
+
+func NewKVBlobs(kv kvStore) *kvBlobs {
+	if kv == nil {
+		panic("kv is nil")
+	}
+
+	return &kvBlobs{
+		kv: kv,
+	}
+}
+
+// Get returns a nil reader when the blob doesn't exist
+func (b *kvBlobs) Get(path string) (io.Reader, error) {
+	data, err := b.kv.Get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+func (b *kvBlobs) Put(path string, data io.Reader) error {
+	value, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to read blob (%s): %w", path, err)
+	}
+
+	return b.kv.Put(path, value)
+}
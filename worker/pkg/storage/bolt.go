@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// OpenBolt opens or creates the bbolt database file shared by bolt stores
+func OpenBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database (%s): %w", path, err)
+	}
+	return db, nil
+}
+
+// boltKV keeps values of one namespace in a separate bbolt bucket
+type boltKV struct {
+	db     *bolt.DB
+	bucket []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewBolt(db *bolt.DB, bucket string, ttl time.Duration) (*boltKV, error) {
+	if db == nil {
+		panic("bolt db is nil")
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bolt bucket (%s): %w", bucket, err)
+	}
+
+	return &boltKV{
+		db:     db,
+		bucket: []byte(bucket),
+		ttl:    ttl,
+		now:    time.Now,
+	}, nil
+}
+
+func (b *boltKV) Get(key string) (value []byte, err error) {
+	var isExpired bool
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		expiresAt, stored, ok := decodeRecord(tx.Bucket(b.bucket).Get([]byte(key)))
+		if !ok {
+			return nil
+		}
+
+		if expired(b.now(), expiresAt) {
+			isExpired = true
+			return nil
+		}
+
+		// stored bytes are only valid during the transaction
+		value = make([]byte, len(stored))
+		copy(value, stored)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from bolt (key: %s): %w", key, err)
+	}
+
+	if isExpired {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			// the key could have been rewritten since it was read
+			expiresAt, _, ok := decodeRecord(tx.Bucket(b.bucket).Get([]byte(key)))
+			if !ok || !expired(b.now(), expiresAt) {
+				return nil
+			}
+			return tx.Bucket(b.bucket).Delete([]byte(key))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete expired key from bolt (key: %s): %w", key, err)
+		}
+	}
+
+	return value, nil
+}
+
+func (b *boltKV) Put(key string, value []byte) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).Put([]byte(key), encodeRecord(expiresAt(b.now(), b.ttl), value))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write to bolt (key: %s): %w", key, err)
+	}
+
+	return nil
+}
+
+func (b *boltKV) Delete(key string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete from bolt (key: %s): %w", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dir stores every value in its own file prefixed with the expiration timestamp
+type dir struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+func NewDir(path string, ttl time.Duration) (*dir, error) {
+	err := os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage directory (%s): %w", path, err)
+	}
+
+	return &dir{
+		path: path,
+		ttl:  ttl,
+		now:  time.Now,
+	}, nil
+}
+
+func (d *dir) Get(key string) ([]byte, error) {
+	record, err := os.ReadFile(d.filePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %w", err)
+	}
+
+	expiresAt, value, ok := decodeRecord(record)
+	if !ok {
+		return nil, nil
+	}
+
+	if expired(d.now(), expiresAt) {
+		_ = os.Remove(d.filePath(key))
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+func (d *dir) Put(key string, value []byte) error {
+	tmp, err := os.CreateTemp(d.path, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create storage file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(encodeRecord(expiresAt(d.now(), d.ttl), value))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write storage file: %w", err)
+	}
+
+	// rename is atomic, so concurrent readers never see a partially written value
+	err = os.Rename(tmp.Name(), d.filePath(key))
+	if err != nil {
+		return fmt.Errorf("failed to replace storage file: %w", err)
+	}
+
+	return nil
+}
+
+func (d *dir) Delete(key string) error {
+	err := os.Remove(d.filePath(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete storage file: %w", err)
+	}
+
+	return nil
+}
+
+// filePath hashes the key, since keys contain slashes and query strings
+func (d *dir) filePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.path, hex.EncodeToString(sum[:]))
+}
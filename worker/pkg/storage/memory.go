@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt int64
+}
+
+// memory is an in-memory LRU store, the least recently used keys are evicted once capacity is exceeded
+type memory struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+// NewMemory creates an LRU store keeping at most capacity keys, zero capacity means unlimited
+func NewMemory(capacity int, ttl time.Duration) *memory {
+	return &memory{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (m *memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := element.Value.(*memoryEntry)
+	if expired(m.now(), entry.expiresAt) {
+		m.remove(element)
+		return nil, nil
+	}
+
+	m.order.MoveToFront(element)
+
+	// copy the value, so callers can't modify the stored data like with the other stores
+	return bytes.Clone(entry.value), nil
+}
+
+func (m *memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// copy the value, so callers can't modify the stored data
+	stored := make([]byte, len(value))
+	copy(stored, value)
+
+	entry := &memoryEntry{
+		key:       key,
+		value:     stored,
+		expiresAt: expiresAt(m.now(), m.ttl),
+	}
+
+	if element, ok := m.entries[key]; ok {
+		element.Value = entry
+		m.order.MoveToFront(element)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(entry)
+
+	for m.capacity > 0 && m.order.Len() > m.capacity {
+		m.remove(m.order.Back())
+	}
+
+	return nil
+}
+
+func (m *memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.entries[key]; ok {
+		m.remove(element)
+	}
+
+	return nil
+}
+
+func (m *memory) remove(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.entries, element.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,38 @@
+// Package storage provides key-value stores for deployments running outside Cloudflare.
+// Every store implements the Get/Put interface of the caching packages: a missing or expired
+// key is reported as a nil value without an error. Delete of a missing key isn't an error either.
+package storage
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const expiryHeaderSize = 8
+
+// expiresAt returns the expiration timestamp for a value written now, zero means the value never expires
+func expiresAt(now time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return now.Add(ttl).UnixNano()
+}
+
+func expired(now time.Time, expiresAt int64) bool {
+	return expiresAt != 0 && now.UnixNano() > expiresAt
+}
+
+// encodeRecord prefixes the value with its expiration timestamp
+func encodeRecord(expiresAt int64, value []byte) []byte {
+	record := make([]byte, expiryHeaderSize, expiryHeaderSize+len(value))
+	binary.BigEndian.PutUint64(record, uint64(expiresAt))
+	return append(record, value...)
+}
+
+// decodeRecord splits a stored record, ok is false for malformed records
+func decodeRecord(record []byte) (expiresAt int64, value []byte, ok bool) {
+	if len(record) < expiryHeaderSize {
+		return 0, nil, false
+	}
+	return int64(binary.BigEndian.Uint64(record[:expiryHeaderSize])), record[expiryHeaderSize:], true
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKV interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+}
+
+func TestStores(t *testing.T) {
+	const ttl = time.Hour
+
+	stores := map[string]func(t *testing.T, now func() time.Time) testKV{
+		"memory": func(t *testing.T, now func() time.Time) testKV {
+			m := NewMemory(0, ttl)
+			m.now = now
+			return m
+		},
+		"dir": func(t *testing.T, now func() time.Time) testKV {
+			d, err := NewDir(t.TempDir(), ttl)
+			require.NoError(t, err)
+			d.now = now
+			return d
+		},
+		"bolt": func(t *testing.T, now func() time.Time) testKV {
+			db, err := OpenBolt(filepath.Join(t.TempDir(), "cache.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			b, err := NewBolt(db, "links", ttl)
+			require.NoError(t, err)
+			b.now = now
+			return b
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+			store := newStore(t, func() time.Time { return now })
+
+			value, err := store.Get("example.com/path?foo=bar")
+			require.NoError(t, err)
+			assert.Nil(t, value)
+
+			err = store.Put("example.com/path?foo=bar", []byte(`["https://example.com/favicon.ico"]`))
+			require.NoError(t, err)
+
+			err = store.Put("example.com", []byte("other"))
+			require.NoError(t, err)
+
+			value, err = store.Get("example.com/path?foo=bar")
+			require.NoError(t, err)
+			assert.Equal(t, `["https://example.com/favicon.ico"]`, string(value))
+
+			// the returned value is the caller's copy
+			value[0] = '{'
+			value, err = store.Get("example.com/path?foo=bar")
+			require.NoError(t, err)
+			assert.Equal(t, `["https://example.com/favicon.ico"]`, string(value))
+
+			err = store.Put("example.com", []byte("overwritten"))
+			require.NoError(t, err)
+
+			value, err = store.Get("example.com")
+			require.NoError(t, err)
+			assert.Equal(t, "overwritten", string(value))
+
+			require.NoError(t, store.Delete("example.com"))
+			require.NoError(t, store.Delete("missing.example.com"))
+
+			value, err = store.Get("example.com")
+			require.NoError(t, err)
+			assert.Nil(t, value)
+
+			now = now.Add(ttl + time.Second)
+
+			value, err = store.Get("example.com/path?foo=bar")
+			require.NoError(t, err)
+			assert.Nil(t, value)
+		})
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemory(2, 0)
+
+	require.NoError(t, m.Put("a", []byte("1")))
+	require.NoError(t, m.Put("b", []byte("2")))
+
+	// touch "a", so "b" becomes the least recently used key
+	value, err := m.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+
+	require.NoError(t, m.Put("c", []byte("3")))
+
+	value, err = m.Get("b")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = m.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+
+	value, err = m.Get("c")
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(value))
+}
+
+func TestBlobs(t *testing.T) {
+	blobDir, err := NewBlobDir(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]interface {
+		Get(path string) (io.Reader, error)
+		Put(path string, data io.Reader) error
+	}{
+		"dir": blobDir,
+		"kv":  NewKVBlobs(NewMemory(0, 0)),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			reader, err := store.Get("icons/abc")
+			require.NoError(t, err)
+			assert.Nil(t, reader)
+
+			err = store.Put("icons/abc", strings.NewReader("icon body"))
+			require.NoError(t, err)
+
+			reader, err = store.Get("icons/abc")
+			require.NoError(t, err)
+			require.NotNil(t, reader)
+
+			body, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "icon body", string(body))
+		})
+	}
+}
+
+func TestBlobDirStaysInsideDirectory(t *testing.T) {
+	root := t.TempDir()
+	blobDir, err := NewBlobDir(filepath.Join(root, "blobs"))
+	require.NoError(t, err)
+
+	err = blobDir.Put("../escaped", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(root, "escaped"))
+	assert.FileExists(t, filepath.Join(root, "blobs", "escaped"))
+}